@@ -0,0 +1,372 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/christianh814/bekind/pkg/config"
+	"github.com/christianh814/bekind/pkg/helm"
+	"github.com/christianh814/bekind/pkg/kind"
+	"github.com/fatih/color"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// chartCmd represents the chart command
+var chartCmd = &cobra.Command{
+	Use:     "chart",
+	Aliases: []string{"helm"},
+	Short:   "Manages the Helm charts of the config on a running cluster",
+	Long: `Manages the releases of the helmCharts in the config file on a running KIND
+cluster, without running the rest of the start steps. Releases are given by
+their release name in the config. For example:
+
+	bekind chart list
+	bekind chart uninstall ingress-nginx
+	bekind chart install traefik --config ~/.bekind/config.yaml`,
+}
+
+// chartListCmd represents the chart list command
+var chartListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Args:    cobra.NoArgs,
+	Short:   "Lists the Helm charts of the config and their releases on the cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		bkc, err := loadChartConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		releases, err := helm.ListReleases()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := printCharts(os.Stdout, bkc.HelmCharts, releases); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// chartInstallCmd represents the chart install command
+var chartInstallCmd = &cobra.Command{
+	Use:   "install <release...>",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Installs or upgrades Helm charts of the config",
+	Run: func(cmd *cobra.Command, args []string) {
+		charts := chartsFromArgs(cmd, args)
+
+		if err := forEachChart(charts, installChart); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// chartUninstallCmd represents the chart uninstall command
+var chartUninstallCmd = &cobra.Command{
+	Use:   "uninstall <release...>",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Uninstalls releases of Helm charts of the config",
+	Long: `Uninstalls the releases of the given helmCharts from the cluster. The
+namespace of the release is left on the cluster.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		charts := chartsFromArgs(cmd, args)
+
+		if err := forEachChart(charts, uninstallChart); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// chartReinstallCmd represents the chart reinstall command
+var chartReinstallCmd = &cobra.Command{
+	Use:   "reinstall <release...>",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Uninstalls and installs Helm charts of the config again",
+	Run: func(cmd *cobra.Command, args []string) {
+		charts := chartsFromArgs(cmd, args)
+
+		if err := forEachChart(charts, func(h config.HelmChart) error {
+			if err := uninstallChart(h); err != nil {
+				return err
+			}
+			return installChart(h)
+		}); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// chartDiffCmd represents the chart diff command
+var chartDiffCmd = &cobra.Command{
+	Use:   "diff [release...]",
+	Short: "Shows what installing the Helm charts would change",
+	Long: `Renders each of the helmCharts in the config file, or only the given
+releases, and shows a diff of each object against the manifest of the release
+on the cluster. Nothing is changed on the cluster. For example:
+
+	bekind chart diff
+	bekind chart diff argocd --config ~/.bekind/config.yaml
+
+Charts are rendered client side, like "helm template", so objects that depend
+on looking up the cluster can show up as changed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		charts := chartsFromArgs(cmd, args)
+
+		if len(charts) == 0 {
+			log.Info("No Helm charts to diff")
+			return
+		}
+
+		if err := diffCharts(os.Stdout, charts, helm.Diff); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// loadChartConfig loads and validates the config, and points helm at its cluster
+func loadChartConfig(cmd *cobra.Command) (*config.BeKindConfig, error) {
+	clusterName, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the bekind config
+	bkc, err := loadBeKindConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := bkc.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := useCluster(bkc.ClusterName(clusterName)); err != nil {
+		return nil, err
+	}
+
+	return bkc, nil
+}
+
+// chartsFromArgs returns the charts of the config for the given releases, all of them if none
+// are given
+func chartsFromArgs(cmd *cobra.Command, args []string) []config.HelmChart {
+	bkc, err := loadChartConfig(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	charts, err := selectCharts(bkc.HelmCharts, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return charts
+}
+
+// requireCluster returns an error if the KIND cluster doesn't exist
+func requireCluster(clusterName string) error {
+	exists, err := clusterExists(clusterName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("KIND cluster %s does not exist", clusterName)
+	}
+
+	return nil
+}
+
+// useCluster checks that the KIND cluster exists and points helm at it, so releases are read and
+// changed on that cluster whatever the current context is
+func useCluster(clusterName string) error {
+	if err := requireCluster(clusterName); err != nil {
+		return err
+	}
+
+	_, kubeContext, err := kind.RestConfig(clusterName)
+	if err != nil {
+		return err
+	}
+	helm.KubeContext = kubeContext
+
+	return nil
+}
+
+// installChart installs or upgrades the release of the chart
+func installChart(h config.HelmChart) error {
+	log.Infof("Installing Helm Chart %s", h.Source())
+
+	result, err := helm.Install(h)
+	if err != nil {
+		return err
+	}
+	log.Info(result.String())
+
+	return nil
+}
+
+// uninstallChart removes the release of the chart, if it's installed
+func uninstallChart(h config.HelmChart) error {
+	uninstalled, err := helm.Uninstall(h)
+	if err != nil {
+		return err
+	}
+
+	if uninstalled {
+		log.Infof("Uninstalled release %s from namespace %s", h.Release, h.Namespace)
+	} else {
+		log.Warnf("Release %s is not installed in namespace %s", h.Release, h.Namespace)
+	}
+
+	return nil
+}
+
+// forEachChart calls fn for each chart in order. A chart that fails doesn't stop the others.
+func forEachChart(charts []config.HelmChart, fn func(config.HelmChart) error) error {
+	var errs []error
+	for _, h := range charts {
+		if err := fn(h); err != nil {
+			errs = append(errs, fmt.Errorf("release %s: %w", h.Release, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// printCharts prints a table of the charts in the config, with their releases on the cluster
+func printCharts(w io.Writer, charts []config.HelmChart, releases []helm.ReleaseStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "RELEASE\tNAMESPACE\tCHART\tVERSION\tINSTALLED\tSTATUS\tUPDATED")
+	for _, h := range charts {
+		version := h.Version
+		if version == "" {
+			version = "latest"
+		}
+
+		installed, status, updated := "-", "not installed", "-"
+		i := slices.IndexFunc(releases, func(r helm.ReleaseStatus) bool {
+			return r.Release == h.Release && r.Namespace == h.Namespace
+		})
+		if i != -1 {
+			r := releases[i]
+			installed, status = r.Chart+" "+r.Version, r.Status
+			updated = r.Updated.Format(time.DateTime)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", h.Release, h.Namespace, h.Source(), version, installed, status, updated)
+	}
+
+	return tw.Flush()
+}
+
+// diffCluster prints the diff of each chart against the given cluster, which has to exist. The
+// releases are read from that cluster, whatever the current context is.
+func diffCluster(clusterName string, charts []config.HelmChart) error {
+	if err := useCluster(clusterName); err != nil {
+		return err
+	}
+
+	if len(charts) == 0 {
+		log.Info("No Helm charts to diff")
+		return nil
+	}
+
+	return diffCharts(os.Stdout, charts, helm.Diff)
+}
+
+// selectCharts returns the charts for the given releases, or all of them if none are given
+func selectCharts(charts []config.HelmChart, releases []string) ([]config.HelmChart, error) {
+	if len(releases) == 0 {
+		return charts, nil
+	}
+
+	var selected []config.HelmChart
+	for _, r := range releases {
+		i := slices.IndexFunc(charts, func(h config.HelmChart) bool { return h.Release == r })
+		if i == -1 {
+			return nil, fmt.Errorf("release %q is not in the helmCharts of the config", r)
+		}
+		selected = append(selected, charts[i])
+	}
+
+	return selected, nil
+}
+
+// diffCharts prints the diff of each chart to w. A chart that can't be diffed doesn't stop the others.
+func diffCharts(w io.Writer, charts []config.HelmChart, diff func(config.HelmChart) (*helm.ReleaseDiff, error)) error {
+	var errs []error
+	for _, h := range charts {
+		d, err := diff(h)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("release %s: %w", h.Release, err))
+			continue
+		}
+		printDiff(w, d)
+	}
+
+	return errors.Join(errs...)
+}
+
+// printDiff prints how the release would change, with added lines in green and removed lines in red
+func printDiff(w io.Writer, d *helm.ReleaseDiff) {
+	header := color.New(color.Bold)
+	switch {
+	case len(d.Objects) == 0:
+		header.Fprintf(w, "release %s in namespace %s: no changes\n", d.Release, d.Namespace)
+		return
+	case !d.Installed:
+		header.Fprintf(w, "release %s in namespace %s: not installed, %d object(s) to add\n", d.Release, d.Namespace, len(d.Objects))
+	default:
+		header.Fprintf(w, "release %s in namespace %s: %d object(s) to change\n", d.Release, d.Namespace, len(d.Objects))
+	}
+
+	for _, o := range d.Objects {
+		header.Fprintf(w, "%s %s\n", o.Change, o.String())
+		for _, line := range strings.Split(strings.TrimRight(o.Diff, "\n"), "\n") {
+			switch {
+			case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+				header.Fprintln(w, line)
+			case strings.HasPrefix(line, "+"):
+				color.New(color.FgGreen).Fprintln(w, line)
+			case strings.HasPrefix(line, "-"):
+				color.New(color.FgRed).Fprintln(w, line)
+			case strings.HasPrefix(line, "@@"):
+				color.New(color.FgCyan).Fprintln(w, line)
+			default:
+				fmt.Fprintln(w, line)
+			}
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(chartCmd)
+
+	chartCmd.AddCommand(chartListCmd)
+	chartCmd.AddCommand(chartInstallCmd)
+	chartCmd.AddCommand(chartUninstallCmd)
+	chartCmd.AddCommand(chartReinstallCmd)
+	chartCmd.AddCommand(chartDiffCmd)
+}
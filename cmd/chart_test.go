@@ -0,0 +1,142 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christianh814/bekind/pkg/config"
+	"github.com/christianh814/bekind/pkg/helm"
+	"github.com/fatih/color"
+)
+
+func TestSelectCharts(t *testing.T) {
+	charts := []config.HelmChart{{Release: "a"}, {Release: "b"}, {Release: "c"}}
+
+	selected, err := selectCharts(charts, nil)
+	if err != nil || len(selected) != 3 {
+		t.Errorf("Expected all charts without releases, got %+v, %v", selected, err)
+	}
+
+	selected, err = selectCharts(charts, []string{"c", "a"})
+	if err != nil {
+		t.Fatalf("selectCharts() returned error: %v", err)
+	}
+	if len(selected) != 2 || selected[0].Release != "c" || selected[1].Release != "a" {
+		t.Errorf("Unexpected charts: %+v", selected)
+	}
+
+	if _, err := selectCharts(charts, []string{"missing"}); err == nil {
+		t.Error("Expected an error for a release that isn't in the config")
+	}
+}
+
+func TestDiffCharts(t *testing.T) {
+	charts := []config.HelmChart{{Release: "web", Namespace: "dev"}, {Release: "broken"}, {Release: "db", Namespace: "dev"}}
+	diff := func(h config.HelmChart) (*helm.ReleaseDiff, error) {
+		switch h.Release {
+		case "broken":
+			return nil, errors.New("chart not found")
+		case "db":
+			return &helm.ReleaseDiff{Release: h.Release, Namespace: h.Namespace, Installed: true}, nil
+		}
+		return &helm.ReleaseDiff{Release: h.Release, Namespace: h.Namespace, Installed: true, Objects: []helm.ObjectDiff{{
+			Kind:   "ConfigMap",
+			Name:   "web",
+			Change: helm.ChangeChanged,
+			Diff:   "--- live\n+++ rendered\n@@ -1 +1 @@\n-color: blue\n+color: green\n",
+		}}}, nil
+	}
+
+	// Compare the output without the colors
+	color.NoColor = true
+
+	var out bytes.Buffer
+	err := diffCharts(&out, charts, diff)
+	if err == nil || !strings.Contains(err.Error(), "release broken: chart not found") {
+		t.Errorf("Expected the broken release to fail, got %v", err)
+	}
+
+	// The other charts are still diffed
+	want := `release web in namespace dev: 1 object(s) to change
+changed ConfigMap/web
+--- live
++++ rendered
+@@ -1 +1 @@
+-color: blue
++color: green
+release db in namespace dev: no changes
+`
+	if out.String() != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestForEachChart(t *testing.T) {
+	charts := []config.HelmChart{{Release: "a"}, {Release: "b"}, {Release: "c"}}
+
+	var done []string
+	err := forEachChart(charts, func(h config.HelmChart) error {
+		done = append(done, h.Release)
+		if h.Release == "b" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "release b: failed" {
+		t.Errorf("Expected release b to fail, got %v", err)
+	}
+	if strings.Join(done, ",") != "a,b,c" {
+		t.Errorf("Expected every chart in order, got %v", done)
+	}
+}
+
+func TestPrintCharts(t *testing.T) {
+	charts := []config.HelmChart{
+		{Url: "https://kubernetes.github.io/ingress-nginx", Repo: "ingress-nginx", Chart: "ingress-nginx", Release: "nginx", Namespace: "ingress", Version: "4.11.3"},
+		{Url: "https://traefik.github.io/charts", Repo: "traefik", Chart: "traefik", Release: "traefik", Namespace: "traefik"},
+	}
+	releases := []helm.ReleaseStatus{
+		{Release: "nginx", Namespace: "ingress", Chart: "ingress-nginx", Version: "4.11.2", Status: "deployed", Updated: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		// Releases in another namespace, or not in the config, are left out
+		{Release: "traefik", Namespace: "default", Chart: "traefik", Version: "1.0.0", Status: "deployed"},
+	}
+
+	var out bytes.Buffer
+	if err := printCharts(&out, charts, releases); err != nil {
+		t.Fatalf("printCharts() returned error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 charts, got:\n%s", out.String())
+	}
+	for i, want := range [][]string{
+		{"RELEASE", "NAMESPACE", "CHART", "VERSION", "INSTALLED", "STATUS", "UPDATED"},
+		{"nginx", "ingress", "ingress-nginx/ingress-nginx", "4.11.3", "ingress-nginx 4.11.2", "deployed", "2026-01-02 03:04:05"},
+		{"traefik", "traefik", "traefik/traefik", "latest", "-", "not installed", "-"},
+	} {
+		for _, w := range want {
+			if !strings.Contains(lines[i], w) {
+				t.Errorf("Expected line %d to contain %q, got %q", i, w, lines[i])
+			}
+		}
+	}
+}
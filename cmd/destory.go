@@ -16,12 +16,9 @@ limitations under the License.
 package cmd
 
 import (
-	"bytes"
-
 	"github.com/christianh814/bekind/pkg/kind"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // destroyCmd represents the destory command
@@ -31,7 +28,8 @@ var destroyCmd = &cobra.Command{
 	Short:   "Destroys the custom Kind cluster",
 	Long: `Destroys a running custom Kind cluster. Currently
 it only destroys the named cluster or it will destroy ones names "kind"
-if one isn't named.`,
+if one isn't named. The local registry in the config is destroyed too,
+if no other KIND cluster is using it.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Get clulster name from CLI
 		clusterName, err := cmd.Flags().GetString("name")
@@ -39,26 +37,39 @@ if one isn't named.`,
 			log.Fatal(err)
 		}
 
-		// Set the kindConfig as the config file for Viper
-		kindConfig := viper.GetString("kindConfig")
-		if len(kindConfig) == 0 {
-			log.Fatal("Could not find kindConfig")
+		// Load the bekind config
+		bkc, err := loadBeKindConfig()
+		if err != nil {
+			log.Fatal(err)
 		}
-		viper.ReadConfig(bytes.NewBuffer([]byte(kindConfig)))
-
-		// Check to see if the cluster name is set in the config file
-		if viper.GetString("name") != "" {
-			clusterName = viper.GetString("name")
+		if len(bkc.KindConfig) == 0 {
+			log.Fatal("Could not find kindConfig")
 		}
 
-		// Set config file back to default for Viper
-		viper.SetConfigFile(cfgFile)
-		viper.ReadInConfig()
+		// Check to see if the cluster name is set in the kindConfig
+		clusterName = bkc.ClusterName(clusterName)
 
 		log.Info("Destroying KIND cluster: ", clusterName)
 		if err := kind.DeleteKindCluster(clusterName, ""); err != nil {
 			log.Fatal(err)
 		}
+
+		// Remove the local registry, unless another cluster still pulls from it
+		if r := bkc.LocalRegistry; r != nil {
+			inUse, err := kind.LocalRegistryInUse(r, clusterName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if inUse {
+				log.Infof("Keeping local registry %s, another KIND cluster is using it", r.ContainerName())
+				return
+			}
+
+			log.Info("Destroying local registry: ", r.ContainerName())
+			if err := kind.DeleteLocalRegistry(r); err != nil {
+				log.Fatal(err)
+			}
+		}
 	},
 }
 
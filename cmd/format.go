@@ -0,0 +1,74 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Formats for the --output flag
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// outputFormat is how list, showconfig and start print their results
+var outputFormat = outputTable
+
+// validOutputFormat returns an error if the format isn't one of the --output formats
+func validOutputFormat(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	}
+
+	return fmt.Errorf("unsupported output format %q, expected %s, %s or %s", format, outputTable, outputJSON, outputYAML)
+}
+
+// printStructured prints v to w as JSON, or as YAML for any other format
+func printStructured(w io.Writer, format string, v interface{}) error {
+	if format == outputJSON {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// yamlToJSON converts a YAML document to indented JSON
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := yamlv3.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(v, "", "  ")
+}
@@ -0,0 +1,74 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestValidOutputFormat(t *testing.T) {
+	for _, f := range []string{"table", "json", "yaml"} {
+		if err := validOutputFormat(f); err != nil {
+			t.Errorf("validOutputFormat(%q) returned error: %v", f, err)
+		}
+	}
+	if err := validOutputFormat("xml"); err == nil {
+		t.Error("Expected an error for xml")
+	}
+}
+
+func TestPrintStructured(t *testing.T) {
+	v := struct {
+		Name  string `json:"name" yaml:"name"`
+		Nodes int    `json:"nodes" yaml:"nodes"`
+	}{Name: "kind", Nodes: 2}
+
+	var out bytes.Buffer
+	if err := printStructured(&out, outputJSON, v); err != nil {
+		t.Fatalf("printStructured() returned error: %v", err)
+	}
+	if want := "{\n  \"name\": \"kind\",\n  \"nodes\": 2\n}\n"; out.String() != want {
+		t.Errorf("Unexpected JSON:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := printStructured(&out, outputYAML, v); err != nil {
+		t.Fatalf("printStructured() returned error: %v", err)
+	}
+	if want := "name: kind\nnodes: 2\n"; out.String() != want {
+		t.Errorf("Unexpected YAML:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestYAMLToJSON(t *testing.T) {
+	data, err := yamlToJSON([]byte("domain: 127.0.0.1.nip.io\nhelmCharts:\n- chart: argo-cd\n  wait: true\n"))
+	if err != nil {
+		t.Fatalf("yamlToJSON() returned error: %v", err)
+	}
+	want := `{
+  "domain": "127.0.0.1.nip.io",
+  "helmCharts": [
+    {
+      "chart": "argo-cd",
+      "wait": true
+    }
+  ]
+}`
+	if string(data) != want {
+		t.Errorf("Unexpected JSON:\n%s\nwant:\n%s", data, want)
+	}
+}
@@ -16,19 +16,35 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
 
 	"github.com/christianh814/bekind/pkg/kind"
+	"github.com/christianh814/bekind/pkg/utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+// clusterListItem is a KIND cluster as it's shown by list
+type clusterListItem struct {
+	kind.ClusterInfo `yaml:",inline"`
+	// CreatedByBekind is set when the cluster has the bekind config saved on it
+	CreatedByBekind bool `json:"createdByBekind" yaml:"createdByBekind"`
+}
+
 // listCmd represents the list command
 var listCmd = &cobra.Command{
 	Use:     "list",
 	Aliases: []string{"ls"},
 	Short:   "List running bekind instances",
-	Long:    `List running bekind instances, it will also list instances that were created by KIND directly.`,
+	Long: `List running bekind instances, it will also list instances that were created by KIND directly.
+
+Each cluster is shown with its node count, node image, Kubernetes version, when it was created
+and whether bekind created it, which is when it has the "bekind-config" secret in "kube-public".`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Get a list of KIND clusters
 		clusters, err := kind.ListKindClusters()
@@ -37,17 +53,73 @@ var listCmd = &cobra.Command{
 		}
 
 		// Check to see if there are any clusters
-		if len(clusters) == 0 {
+		if len(clusters) == 0 && outputFormat == outputTable {
 			log.Info("No clusters found")
+			return
 		}
 
-		// list clusters
+		items := []clusterListItem{}
 		for _, cluster := range clusters {
-			fmt.Println(cluster)
+			item := clusterListItem{ClusterInfo: kind.ClusterInfo{Name: cluster}}
+			info, err := kind.DescribeKindCluster(cluster)
+			if err != nil {
+				log.Warnf("Could not describe KIND cluster %s: %v", cluster, err)
+			} else {
+				item.ClusterInfo = *info
+			}
+			item.CreatedByBekind = createdByBekind(cluster)
+			items = append(items, item)
+		}
+
+		// list clusters
+		if err := printClusters(os.Stdout, outputFormat, items); err != nil {
+			log.Fatal(err)
 		}
 	},
 }
 
+// createdByBekind checks if the KIND cluster has the bekind config saved on it
+func createdByBekind(name string) bool {
+	rc, _, err := kind.RestConfig(name)
+	if err != nil {
+		log.Debugf("Could not get kubeconfig for KIND cluster %s: %v", name, err)
+		return false
+	}
+	rc.Timeout = 5 * time.Second
+
+	if _, err := utils.GetBeKindConfig(rc, context.TODO(), stateNamespace, "bekind-config"); err != nil {
+		log.Debugf("No bekind config on KIND cluster %s: %v", name, err)
+		return false
+	}
+
+	return true
+}
+
+// printClusters prints the clusters as a table, or as JSON or YAML
+func printClusters(w io.Writer, format string, items []clusterListItem) error {
+	if format != outputTable {
+		return printStructured(w, format, items)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tNODES\tKUBERNETES\tIMAGE\tCREATED\tBEKIND")
+	for _, c := range items {
+		version, image, created := c.KubernetesVersion, c.NodeImage, "-"
+		if version == "" {
+			version = "-"
+		}
+		if image == "" {
+			image = "-"
+		}
+		if !c.Created.IsZero() {
+			created = c.Created.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%t\n", c.Name, c.Nodes, version, image, created, c.CreatedByBekind)
+	}
+
+	return tw.Flush()
+}
+
 func init() {
 	rootCmd.AddCommand(listCmd)
 }
@@ -0,0 +1,80 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christianh814/bekind/pkg/kind"
+)
+
+func TestPrintClusters(t *testing.T) {
+	created := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+	items := []clusterListItem{
+		{
+			ClusterInfo: kind.ClusterInfo{
+				Name:              "dev",
+				Nodes:             2,
+				NodeImage:         "kindest/node:v1.34.0",
+				KubernetesVersion: "v1.34.0",
+				Created:           created,
+			},
+			CreatedByBekind: true,
+		},
+		{ClusterInfo: kind.ClusterInfo{Name: "other"}},
+	}
+
+	var out bytes.Buffer
+	if err := printClusters(&out, outputTable, items); err != nil {
+		t.Fatalf("printClusters() returned error: %v", err)
+	}
+	stamp := created.Local().Format(time.DateTime)
+	want := "NAME    NODES   KUBERNETES   IMAGE                  CREATED" + strings.Repeat(" ", len(stamp)-4) + "BEKIND\n" +
+		"dev     2       v1.34.0      kindest/node:v1.34.0   " + stamp + "   true\n" +
+		"other   0       -            -                      -" + strings.Repeat(" ", len(stamp)+2) + "false\n"
+	if out.String() != want {
+		t.Errorf("Unexpected table:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// The cluster info is inlined next to createdByBekind
+	out.Reset()
+	if err := printClusters(&out, outputYAML, items[:1]); err != nil {
+		t.Fatalf("printClusters() returned error: %v", err)
+	}
+	want = `- name: dev
+  nodes: 2
+  nodeImage: kindest/node:v1.34.0
+  kubernetesVersion: v1.34.0
+  created: 2025-06-01T12:30:00Z
+  createdByBekind: true
+`
+	if out.String() != want {
+		t.Errorf("Unexpected YAML:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := printClusters(&out, outputJSON, items[:1]); err != nil {
+		t.Fatalf("printClusters() returned error: %v", err)
+	}
+	for _, s := range []string{`"name": "dev"`, `"kubernetesVersion": "v1.34.0"`, `"created": "2025-06-01T12:30:00Z"`, `"createdByBekind": true`} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Expected %s in JSON:\n%s", s, out.String())
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+
+	"github.com/christianh814/bekind/pkg/config"
+	"github.com/christianh814/bekind/pkg/kind"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// loadCmd represents the load command
+var loadCmd = &cobra.Command{
+	Use:   "load [image...]",
+	Short: "Loads images into a running KIND cluster",
+	Long: `Loads images into the nodes of a running KIND cluster, without
+recreating it. Images that are already on a node are skipped.
+
+Use --nodes to only load the images onto some of the nodes, by role
+("control-plane" or "worker") or node name. Use --from-config to load
+the images in the loadDockerImages section of the config file. For example:
+
+	bekind load my-app:dev
+	bekind load my-app:dev --pull --nodes worker
+	bekind load --from-config --config ~/.bekind/config.yaml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Get the flags
+		clusterName, err := cmd.Flags().GetString("name")
+		if err != nil {
+			log.Fatal(err)
+		}
+		pull, err := cmd.Flags().GetBool("pull")
+		if err != nil {
+			log.Fatal(err)
+		}
+		nodes, err := cmd.Flags().GetStringSlice("nodes")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fromConfig, err := cmd.Flags().GetBool("from-config")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Load the bekind config
+		bkc, err := loadBeKindConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// The config decides whether to pull its images, unless --pull is given
+		if fromConfig && !cmd.Flags().Changed("pull") {
+			pull = bkc.LoadDockerImages.PullImages
+		}
+
+		images, err := imagesToLoad(bkc, args, nodes, fromConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Check to see if the cluster name is set in the kindConfig
+		clusterName = bkc.ClusterName(clusterName)
+
+		exists, err := clusterExists(clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !exists {
+			log.Fatalf("KIND cluster %s does not exist", clusterName)
+		}
+
+		log.Infof("Loading %d image(s) into KIND cluster %s from %s", len(images), clusterName, kind.Images.Name())
+		if err := kind.LoadDockerImage(images, clusterName, pull); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// imagesToLoad returns the images given on the command line, loaded onto the given nodes, and
+// the images from the config when fromConfig is set
+func imagesToLoad(bkc *config.BeKindConfig, args []string, nodes []string, fromConfig bool) ([]config.Image, error) {
+	var images []config.Image
+	if fromConfig {
+		if len(bkc.LoadDockerImages.Images) == 0 {
+			return nil, errors.New("no images found in the loadDockerImages section of the config")
+		}
+		images = append(images, bkc.LoadDockerImages.Images...)
+	}
+
+	for _, arg := range args {
+		images = append(images, config.Image{Name: arg, Nodes: nodes})
+	}
+
+	if len(images) == 0 {
+		return nil, errors.New("no images given, pass the images to load or use --from-config")
+	}
+
+	return images, nil
+}
+
+func init() {
+	rootCmd.AddCommand(loadCmd)
+
+	loadCmd.Flags().Bool("pull", false, "Pull the images before loading them")
+	loadCmd.Flags().StringSlice("nodes", nil, "Only load the images onto these nodes, by role or name")
+	loadCmd.Flags().Bool("from-config", false, "Load the images from the loadDockerImages section of the config file")
+}
@@ -0,0 +1,62 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"testing"
+
+	"github.com/christianh814/bekind/pkg/config"
+)
+
+func TestImagesToLoad(t *testing.T) {
+	bkc := config.New()
+
+	// Nothing to load
+	if _, err := imagesToLoad(bkc, nil, nil, false); err == nil {
+		t.Error("imagesToLoad should fail without any images")
+	}
+	if _, err := imagesToLoad(bkc, nil, nil, true); err == nil {
+		t.Error("imagesToLoad should fail when the config has no images")
+	}
+
+	// Images from the command line get the given nodes
+	images, err := imagesToLoad(bkc, []string{"my-app:dev", "my-api:dev"}, []string{"worker"}, false)
+	if err != nil {
+		t.Fatalf("imagesToLoad() returned error: %v", err)
+	}
+	if len(images) != 2 || images[1].Name != "my-api:dev" || len(images[1].Nodes) != 1 || images[1].Nodes[0] != "worker" {
+		t.Errorf("Unexpected images: %+v", images)
+	}
+
+	// Images from the config keep their own nodes
+	bkc.LoadDockerImages.Images = []config.Image{{Name: "nginx:1.25"}, {Name: "redis:7", Nodes: []string{"kind-worker2"}}}
+	images, err = imagesToLoad(bkc, []string{"my-app:dev"}, nil, true)
+	if err != nil {
+		t.Fatalf("imagesToLoad() returned error: %v", err)
+	}
+	if len(images) != 3 {
+		t.Fatalf("Expected 3 images, got %d", len(images))
+	}
+	if images[0].Name != "nginx:1.25" || len(images[0].Nodes) != 0 {
+		t.Errorf("Expected nginx:1.25 on all nodes, got %+v", images[0])
+	}
+	if images[1].Nodes[0] != "kind-worker2" {
+		t.Errorf("Expected redis:7 to keep its nodes, got %+v", images[1])
+	}
+	if images[2].Name != "my-app:dev" {
+		t.Errorf("Expected my-app:dev last, got %+v", images[2])
+	}
+}
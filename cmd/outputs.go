@@ -0,0 +1,167 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/christianh814/bekind/pkg/config"
+	"github.com/christianh814/bekind/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// sourcedOutput is an output with the release it's from, empty for the top level outputs
+type sourcedOutput struct {
+	Release string
+	config.Output
+}
+
+// outputValue is the value read for an output
+type outputValue struct {
+	Release string `json:"release,omitempty" yaml:"release,omitempty"`
+	Name    string `json:"name" yaml:"name"`
+	Value   string `json:"value" yaml:"value"`
+}
+
+// startResult is what start prints with --output json or yaml
+type startResult struct {
+	Name       string `json:"name" yaml:"name"`
+	Kubeconfig string `json:"kubeconfig" yaml:"kubeconfig"`
+	Context    string `json:"context,omitempty" yaml:"context,omitempty"`
+	APIServer  string `json:"apiServer,omitempty" yaml:"apiServer,omitempty"`
+	// Registry is the host the local registry is pushed to, when there is one
+	Registry string        `json:"registry,omitempty" yaml:"registry,omitempty"`
+	Outputs  []outputValue `json:"outputs" yaml:"outputs"`
+}
+
+// configOutputs returns the outputs of each chart, then the top level outputs of the config
+func configOutputs(bkc *config.BeKindConfig) []sourcedOutput {
+	var outputs []sourcedOutput
+	for _, h := range bkc.HelmCharts {
+		for _, o := range h.ChartOutputs() {
+			outputs = append(outputs, sourcedOutput{Release: h.Release, Output: o})
+		}
+	}
+	for _, o := range bkc.Outputs {
+		outputs = append(outputs, sourcedOutput{Output: o})
+	}
+
+	return outputs
+}
+
+// readOutputs reads the value of each output with get. Outputs with the same release and name
+// are tried in order until one is found, like an Ingress or else an HTTPRoute.
+func readOutputs(outputs []sourcedOutput, get func(config.Output) (string, error)) []outputValue {
+	var values []outputValue
+	index := make(map[[2]string]int)
+	for _, o := range outputs {
+		key := [2]string{o.Release, o.Name}
+		i, seen := index[key]
+		if !seen {
+			i = len(values)
+			index[key] = i
+			values = append(values, outputValue{Release: o.Release, Name: o.Name})
+		}
+		if values[i].Value != "" {
+			continue
+		}
+
+		kind, name := o.Object()
+		value, err := get(o.Output)
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				log.Debugf("Output %q: %s %s/%s not found", o.Name, kind, o.Namespace, name)
+			} else {
+				log.Warnf("Could not read output %q: %v", o.Name, err)
+			}
+			continue
+		}
+		values[i].Value = value
+	}
+
+	return values
+}
+
+// printOutputs prints a table of the output values, outputs that weren't found are shown as "-"
+func printOutputs(w io.Writer, values []outputValue) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "RELEASE\tOUTPUT\tVALUE")
+	for _, v := range values {
+		release, value := v.Release, v.Value
+		if release == "" {
+			release = "-"
+		}
+		if value == "" {
+			value = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", release, v.Name, value)
+	}
+
+	return tw.Flush()
+}
+
+// showOutputs reads the outputs of the config from the cluster and prints them as a table. With
+// --output json or yaml nothing is printed, the start result with the outputs in it is returned.
+func showOutputs(s *startState) *startResult {
+	values := []outputValue{}
+	outputs := configOutputs(s.bkc)
+	// The start result has the API server in it, so connect even without outputs
+	if len(outputs) > 0 || outputFormat != outputTable {
+		if err := s.connect(); err != nil {
+			log.Warnf("Could not read outputs: %v", err)
+		} else {
+			values = append(values, readOutputs(outputs, func(o config.Output) (string, error) {
+				return utils.GetOutput(s.restConfig, s.ctx, o)
+			})...)
+		}
+	}
+
+	if outputFormat != outputTable {
+		r := newStartResult(s, values)
+		return &r
+	}
+
+	if len(values) > 0 {
+		if err := printOutputs(os.Stdout, values); err != nil {
+			log.Warnf("Could not print outputs: %v", err)
+		}
+	}
+	return nil
+}
+
+// newStartResult returns the result of starting the cluster, with the given output values. The
+// context and API server are both from the kubeconfig KIND has for the cluster.
+func newStartResult(s *startState, values []outputValue) startResult {
+	r := startResult{
+		Name:       s.clusterName,
+		Kubeconfig: clientcmd.NewDefaultPathOptions().GetDefaultFilename(),
+		Context:    s.kubeContext,
+		Outputs:    values,
+	}
+	if s.restConfig != nil {
+		r.APIServer = s.restConfig.Host
+	}
+	if s.bkc.LocalRegistry != nil {
+		r.Registry = s.bkc.LocalRegistry.Host()
+	}
+
+	return r
+}
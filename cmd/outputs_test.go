@@ -0,0 +1,143 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/christianh814/bekind/pkg/config"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+func TestConfigOutputs(t *testing.T) {
+	bkc := &config.BeKindConfig{
+		HelmCharts: []config.HelmChart{
+			{Chart: "grafana", Release: "grafana", Namespace: "monitoring", Outputs: []config.Output{{Name: "url", Ingress: "grafana"}}},
+			{Chart: "argo-cd", Release: "argocd", Namespace: "gitops", Outputs: []config.Output{
+				{Name: "url", Ingress: "argocd-server", Format: "https://%s"},
+				{Name: "admin password", Secret: "argocd-initial-admin-secret", Key: "password"},
+			}},
+		},
+		Outputs: []config.Output{{Name: "app", Service: "my-app"}},
+	}
+
+	outputs := configOutputs(bkc)
+	if len(outputs) != 4 {
+		t.Fatalf("Expected 4 outputs, got %+v", outputs)
+	}
+	if outputs[0].Release != "grafana" || outputs[0].Namespace != "monitoring" {
+		t.Errorf("Expected the chart's namespace for its outputs, got %+v", outputs[0])
+	}
+	if outputs[1].Release != "argocd" || outputs[1].Ingress != "argocd-server" || outputs[1].Namespace != "gitops" {
+		t.Errorf("Expected the Argo CD url output, got %+v", outputs[1])
+	}
+	if outputs[3].Release != "" || outputs[3].Service != "my-app" || outputs[3].Namespace != "" {
+		t.Errorf("Expected the top level output last, got %+v", outputs[3])
+	}
+}
+
+func TestReadOutputs(t *testing.T) {
+	outputs := []sourcedOutput{
+		{Release: "argocd", Output: config.Output{Name: "url", Ingress: "argocd-server", Namespace: "argocd"}},
+		{Release: "argocd", Output: config.Output{Name: "url", HTTPRoute: "argocd-server", Namespace: "argocd"}},
+		{Release: "argocd", Output: config.Output{Name: "admin password", Secret: "argocd-initial-admin-secret", Key: "password", Namespace: "argocd"}},
+		{Output: config.Output{Name: "app", Service: "my-app"}},
+		{Output: config.Output{Name: "broken", ConfigMap: "cm", Key: "missing"}},
+	}
+
+	var read []string
+	values := readOutputs(outputs, func(o config.Output) (string, error) {
+		kind, name := o.Object()
+		read = append(read, kind)
+		switch kind {
+		case "Ingress", "Secret":
+			return "", k8serrors.NewNotFound(schema.GroupResource{Resource: strings.ToLower(kind)}, name)
+		case "ConfigMap":
+			return "", errors.New("nothing found")
+		case "HTTPRoute":
+			return "https://argocd.127.0.0.1.nip.io", nil
+		}
+		return "30080", nil
+	})
+
+	// The HTTPRoute is tried when the Ingress isn't there
+	if strings.Join(read, ",") != "Ingress,HTTPRoute,Secret,Service,ConfigMap" {
+		t.Errorf("Unexpected objects read: %v", read)
+	}
+	expected := []outputValue{
+		{Release: "argocd", Name: "url", Value: "https://argocd.127.0.0.1.nip.io"},
+		{Release: "argocd", Name: "admin password"},
+		{Name: "app", Value: "30080"},
+		{Name: "broken"},
+	}
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %d values, got %+v", len(expected), values)
+	}
+	for i, v := range expected {
+		if values[i] != v {
+			t.Errorf("Expected %+v, got %+v", v, values[i])
+		}
+	}
+
+	var out bytes.Buffer
+	if err := printOutputs(&out, values); err != nil {
+		t.Fatalf("printOutputs() returned error: %v", err)
+	}
+	want := `RELEASE   OUTPUT           VALUE
+argocd    url              https://argocd.127.0.0.1.nip.io
+argocd    admin password   -
+-         app              30080
+-         broken           -
+`
+	if out.String() != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestNewStartResult(t *testing.T) {
+	t.Setenv("KUBECONFIG", "/tmp/bekind-test/config")
+	s := &startState{
+		bkc:         &config.BeKindConfig{LocalRegistry: &config.LocalRegistry{}},
+		clusterName: "dev",
+		restConfig:  &rest.Config{Host: "https://127.0.0.1:6443"},
+		kubeContext: "kind-dev",
+	}
+
+	r := newStartResult(s, []outputValue{{Release: "argocd", Name: "url", Value: "https://argocd.127.0.0.1.nip.io"}})
+	var out bytes.Buffer
+	if err := printStructured(&out, outputYAML, r); err != nil {
+		t.Fatalf("printStructured() returned error: %v", err)
+	}
+	want := fmt.Sprintf(`name: dev
+kubeconfig: /tmp/bekind-test/config
+context: kind-dev
+apiServer: https://127.0.0.1:6443
+registry: localhost:%d
+outputs:
+- release: argocd
+  name: url
+  value: https://argocd.127.0.0.1.nip.io
+`, config.DefaultRegistryPort)
+	if out.String() != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/christianh814/bekind/pkg/config"
+	"github.com/christianh814/bekind/pkg/helm"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// prefetchCmd represents the prefetch command
+var prefetchCmd = &cobra.Command{
+	Use:   "prefetch [profile]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Downloads the Helm charts of a config or profile for installing offline",
+	Long: `Downloads every chart in the helmCharts of the config file, or of every
+YAML file in the given profile, into the chart cache in ~/.bekind/helm/charts.
+The digest of each chart is recorded, and checked when it's installed.
+
+Charts are cached at the version in the config, so pin the version of each
+chart to get the same one every time. Local charts are skipped.
+
+Once the charts are cached, use --offline with start or run to install them
+without network access. For example:
+
+	bekind prefetch --config ~/.bekind/config.yaml
+	bekind prefetch argocd
+	bekind run argocd --offline`,
+	ValidArgsFunction: profileValidArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var configs []*config.BeKindConfig
+
+		if len(args) == 0 {
+			// Prefetch the charts of the config file that "start" would use
+			bkc, err := loadBeKindConfig()
+			if err != nil {
+				log.Fatal(err)
+			}
+			configs = append(configs, bkc)
+		} else {
+			// Look for all yaml files in the profile directory
+			configFiles, err := filepath.Glob(filepath.Join(ProfileDir+"/"+args[0], "*.yaml"))
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if len(configFiles) == 0 {
+				log.Fatalf("No config files found in profile directory: %s", ProfileDir+"/"+args[0])
+			}
+
+			for _, configFile := range configFiles {
+				bkc, err := config.Load(configFile)
+				if err != nil {
+					log.Fatal(err)
+				}
+				configs = append(configs, bkc)
+			}
+		}
+
+		for _, bkc := range configs {
+			if err := bkc.Validate(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if err := prefetchCharts(configs, helm.Prefetch); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// prefetchCharts calls prefetch once for each chart in the configs, skipping local charts.
+// A chart that fails doesn't stop the others.
+func prefetchCharts(configs []*config.BeKindConfig, prefetch func(config.HelmChart) (*helm.CachedChart, error)) error {
+	var (
+		errs []error
+		seen = make(map[string]bool)
+	)
+	for _, bkc := range configs {
+		for _, h := range bkc.HelmCharts {
+			if h.IsLocal() {
+				log.Infof("Skipping local chart %s", h.Source())
+				continue
+			}
+
+			// The same chart can be in more than one config of a profile
+			key := h.Source() + "@" + h.Version + h.Digest
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			cached, err := prefetch(h)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("release %s: %w", h.Release, err))
+				continue
+			}
+			if h.Version == "" {
+				log.Warnf("Chart %s isn't pinned to a version, cached the latest (%s)", h.Source(), cached.ChartVersion)
+			}
+			log.Infof("Cached chart %s %s (%s)", cached.Name, cached.ChartVersion, cached.Digest)
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	log.Infof("Charts are cached in %s", helm.ChartCache)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(prefetchCmd)
+
+	prefetchCmd.Flags().StringVarP(&ProfileDir, "profile-dir", "p", ProfileDir, "Directory where profiles are stored")
+}
@@ -0,0 +1,57 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/christianh814/bekind/pkg/config"
+	"github.com/christianh814/bekind/pkg/helm"
+)
+
+func TestPrefetchCharts(t *testing.T) {
+	configs := []*config.BeKindConfig{
+		{HelmCharts: []config.HelmChart{
+			{Url: "https://charts.example.com", Repo: "example", Chart: "web", Release: "web", Version: "1.0.0"},
+			{Path: "./charts/local", Release: "local"},
+			{Url: "oci://registry.example.com/charts/broken", Release: "broken"},
+		}},
+		// The same chart in another config of the profile is only fetched once
+		{HelmCharts: []config.HelmChart{
+			{Url: "https://charts.example.com", Repo: "example", Chart: "web", Release: "web2", Version: "1.0.0"},
+			{Url: "https://charts.example.com", Repo: "example", Chart: "web", Release: "web3", Version: "2.0.0"},
+		}},
+	}
+
+	var fetched []string
+	prefetch := func(h config.HelmChart) (*helm.CachedChart, error) {
+		fetched = append(fetched, h.Release)
+		if h.Release == "broken" {
+			return nil, errors.New("not found")
+		}
+		return &helm.CachedChart{Name: h.Chart, ChartVersion: h.Version, Digest: "sha256:abc"}, nil
+	}
+
+	err := prefetchCharts(configs, prefetch)
+	if err == nil || !strings.Contains(err.Error(), "release broken: not found") {
+		t.Errorf("Expected the broken release to fail, got %v", err)
+	}
+	if strings.Join(fetched, ",") != "web,broken,web3" {
+		t.Errorf("Unexpected charts fetched: %v", fetched)
+	}
+}
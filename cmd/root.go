@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/christianh814/bekind/pkg/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -36,6 +37,9 @@ The KIND cluster is then configured based on what configuration file is passed.`
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return validOutputFormat(outputFormat)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -56,6 +60,7 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.bekind/config.yaml)")
 	rootCmd.PersistentFlags().String("name", "kind", "The name of the kind instance")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputFormat, "Output format for list, showconfig and start: table, json or yaml")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -84,3 +89,14 @@ func initConfig() {
 	}
 
 }
+
+// loadBeKindConfig loads the bekind config from the file viper found (or was given with --config)
+func loadBeKindConfig() (*config.BeKindConfig, error) {
+	configFile := viper.ConfigFileUsed()
+	if configFile == "" {
+		// No config file was found, so use the defaults
+		return config.New(), nil
+	}
+
+	return config.Load(configFile)
+}
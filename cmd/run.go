@@ -20,9 +20,9 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/christianh814/bekind/pkg/config"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // Set ProfileDir
@@ -60,38 +60,38 @@ var runCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
+		// With --output json or yaml the results of all the configs are printed together at the end
+		results := []interface{}{}
+
 		// Iterate over all config files and run the profile for each one
 		for _, configFile := range configFiles {
-			// Set Config file based on the profile
-			viper.SetConfigFile(configFile)
-
-			// Read the config file, Only displaying an error if there was a problem reading the file.
-			if err := viper.ReadInConfig(); err != nil {
-				if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-					log.Fatal(err)
-				}
+			// Load the config file for this iteration of the profile
+			bkc, err := config.Load(configFile)
+			if err != nil {
+				log.Fatal(err)
 			}
 
 			// If the view flag is set, show the config
 			if view {
-				// Crude, but it works
-				// TODO: Create a "BeKindStack" YAML struct and use that to display the config
+				byteSlice, err := bkc.Marshal()
+				if err != nil {
+					log.Fatal(err)
+				}
 				fmt.Println("---")
-				showconfigCmd.Run(cmd, []string{})
+				fmt.Print(string(byteSlice))
 			} else {
 				// I assume you want to "Run the profile"
-				if !view {
-					log.Info("Running profile: ", args[0], " with config file: ", filepath.Base(configFile))
-					startCmd.Run(cmd, []string{})
+				log.Info("Running profile: ", args[0], " with config file: ", filepath.Base(configFile))
+				if r := startCluster(cmd, bkc); r != nil {
+					results = append(results, r)
 				}
-
 			}
+		}
 
-			// Clear viper config for next iteration
-			viper.Reset()
-
-			// Reset global variables from start.go to prevent state leakage between iterations
-			ResetGlobalVars()
+		if outputFormat != outputTable && !view {
+			if err := printStructured(os.Stdout, outputFormat, results); err != nil {
+				log.Fatal(err)
+			}
 		}
 	},
 }
@@ -102,6 +102,9 @@ func init() {
 	// Add a view flag that takes a string argument
 	runCmd.Flags().BoolP("view", "v", false, "View the profile configuration")
 
+	// Add the flags that control which start steps are run
+	addStartFlags(runCmd)
+
 	// Add a profile-dir flag that takes a string argument use StringVar
 	runCmd.Flags().StringVarP(&ProfileDir, "profile-dir", "p", ProfileDir, "Directory where profiles are stored")
 
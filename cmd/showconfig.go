@@ -24,7 +24,6 @@ import (
 	"github.com/christianh814/bekind/pkg/utils"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"gopkg.in/yaml.v2"
 )
 
 // showconfigCmd represents the showconfig command
@@ -35,7 +34,9 @@ var showconfigCmd = &cobra.Command{
 	Long: `Prints out the config that will be used by bekind to set up your local Kind cluster.
 
 In the case you use --system it will print out the config that is saved on the cluster. This is
-usually the "config.yaml" value in the "bekind-config" secret in the "kube-public" namespace.`,
+usually the "config.yaml" value in the "bekind-config" secret in the "kube-public" namespace.
+
+The config is printed as YAML, use --output json to print it as JSON.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var byteSlice []byte
 		var err error
@@ -49,14 +50,28 @@ usually the "config.yaml" value in the "bekind-config" secret in the "kube-publi
 				log.Fatal(err)
 			}
 		} else {
-			// Marshal in the entire config file int a byteslice and check for errors
-			byteSlice, err = yaml.Marshal(viper.AllSettings())
+			// Load the config file and marshal it into a byteslice
+			bkc, err := loadBeKindConfig()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			byteSlice, err = bkc.Marshal()
 			if err != nil {
 				log.Fatal(err)
 			}
 
 		}
 
+		// The config is YAML, so only JSON needs converting
+		if outputFormat == outputJSON {
+			byteSlice, err = yamlToJSON(byteSlice)
+			if err != nil {
+				log.Fatal(err)
+			}
+			byteSlice = append(byteSlice, '\n')
+		}
+
 		// Print it out
 		fmt.Print(string(byteSlice))
 
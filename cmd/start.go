@@ -16,377 +16,226 @@ limitations under the License.
 package cmd
 
 import (
-	"bytes"
 	"context"
-	"fmt"
 	"os"
+	"slices"
+	"strings"
 
+	"github.com/christianh814/bekind/pkg/config"
 	"github.com/christianh814/bekind/pkg/helm"
 	"github.com/christianh814/bekind/pkg/kind"
-	"github.com/christianh814/bekind/pkg/utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"gopkg.in/yaml.v2"
-	v1 "k8s.io/api/core/v1"
-	networkingv1 "k8s.io/api/networking/v1"
-	k8serrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
 )
 
-// convertMapInterface recursively converts map[interface{}]interface{} to map[string]interface{}
-func convertMapInterface(data interface{}) interface{} {
-	switch v := data.(type) {
-	case map[interface{}]interface{}:
-		result := make(map[string]interface{})
-		for key, value := range v {
-			strKey := fmt.Sprintf("%v", key)
-			result[strKey] = convertMapInterface(value)
-		}
-		return result
-	case []interface{}:
-		for i, item := range v {
-			v[i] = convertMapInterface(item)
-		}
-		return v
-	default:
-		return data
-	}
-}
-
-// pullImages set to true by default
-var pullImages bool = true
-
-// HelmValues is the values provied in the configfile
-type HelmValues struct {
-	Name  string
-	Value string
-}
-
-// HC is the extra helmcharts to install, if provided
-var HC []struct {
-	Url          string
-	Repo         string
-	Chart        string
-	Release      string
-	Namespace    string
-	ValuesObject map[string]interface{}
-	Wait         bool
-	Version      string
-}
-
-// Set Default domain
-var Domain string = "127.0.0.1.nip.io"
-
-// Set the default Kind Image version
-var KindImageVersion string
-
-// ResetGlobalVars resets all global variables to their default state
-// This is needed when running multiple profiles in sequence
-func ResetGlobalVars() {
-	log.Debug("Resetting global variables for next profile iteration")
-	HC = nil // Clear the helm charts slice
-	pullImages = true
-	Domain = "127.0.0.1.nip.io"
-	KindImageVersion = ""
-}
-
 // startCmd represents the start command
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Starts a custom Kind cluster",
 	Long: `This command starts a custom Kind cluster based 
-on the configuration file that is passed`,
-	Run: func(cmd *cobra.Command, args []string) {
-		log.Info("Starting KIND cluster")
+on the configuration file that is passed.
+
+Use --dry-run to print the steps that would be taken, without
+touching docker or any cluster. The Helm repos of the helmCharts are
+still added to bekind's repo config and their indexes refreshed, to
+resolve the chart versions. Add --offline to resolve them from the
+chart cache instead.
+
+The steps are: cluster, registry, workers, images, helm, manifests,
+actions and save-config. The steps that complete are recorded on the cluster,
+so if one fails you can fix the problem and continue with --resume.
+You can also re-run steps against an existing cluster with
+--from-step (that step and everything after it) or --only.
 
-		// Get clulster name from CLI
-		clusterName, err := cmd.Flags().GetString("name")
+Use --diff-only to show what installing the helmCharts would change on
+the existing cluster, without changing anything.
+
+Use --offline to install the helmCharts from the chart cache that
+"bekind prefetch" downloads them into, without updating any Helm repos.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Load the bekind config
+		bkc, err := loadBeKindConfig()
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		// check to see if the user wants to pull images before loading them into the cluster
-		if viper.IsSet("loadDockerImages.pullImages") {
-			pullImages = viper.GetBool("loadDockerImages.pullImages")
-		}
-
-		// Get "domain" from the config file if it exists using viper
-		// Leaving this here although not using "domain" anymore, it might
-		// be useful in the future.
-		if viper.GetString("domain") != "" {
-			Domain = viper.GetString("domain")
-			log.Warn("Using custom domain")
+		if r := startCluster(cmd, bkc); r != nil {
+			if err := printStructured(os.Stdout, outputFormat, r); err != nil {
+				log.Fatal(err)
+			}
 		}
+	},
+}
 
-		// Get "kindImageVersion" from the config file if it exists using viper
-		if viper.GetString("kindImageVersion") != "" {
-			KindImageVersion = viper.GetString("kindImageVersion")
-			log.Warn("Using custom KIND node image " + KindImageVersion)
-		} else {
-			log.Info("Using default KIND node image")
+// startCluster runs the start pipeline for the KIND cluster described by the given config. With
+// --output json or yaml it returns what to print, the plan for --dry-run or else the start result,
+// and nil when there is nothing to print.
+func startCluster(cmd *cobra.Command, bkc *config.BeKindConfig) interface{} {
+	// Make sure the config is usable before we do anything
+	if err := bkc.Validate(); err != nil {
+		log.Fatal(err)
+	}
 
-		}
+	// Get clulster name from CLI
+	clusterName, err := cmd.Flags().GetString("name")
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		// Get images to load from the config file. NOTE: Images must exist on the host FIRST.
-		dockerImages := viper.GetStringSlice("loadDockerImages.images")
+	// Get the flags that control which steps run
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		log.Fatal(err)
+	}
+	resume, err := cmd.Flags().GetBool("resume")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fromStep, err := cmd.Flags().GetString("from-step")
+	if err != nil {
+		log.Fatal(err)
+	}
+	only, err := cmd.Flags().GetStringSlice("only")
+	if err != nil {
+		log.Fatal(err)
+	}
+	diffOnly, err := cmd.Flags().GetBool("diff-only")
+	if err != nil {
+		log.Fatal(err)
+	}
+	offline, err := cmd.Flags().GetBool("offline")
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		// Get post install manifests. NOTE: these need to be in YAML format currently
-		// TODO: support for JSON formatted K8S Manifests
-		postInstallManifests := viper.GetStringSlice("postInstallManifests")
+	// Install the helm charts from the chart cache, without the network
+	helm.Offline = offline
 
-		// Get post install actions if any
-		var postInstallActions []utils.PostInstallAction
-		if viper.IsSet("postInstallActions") {
-			if err := viper.UnmarshalKey("postInstallActions", &postInstallActions); err != nil {
-				log.Warn("Issue parsing postInstallActions: ", err)
-			}
-		}
+	s := &startState{
+		ctx: context.TODO(),
+		bkc: bkc,
+		// Check to see if the cluster name is set in the kindConfig
+		clusterName: bkc.ClusterName(clusterName),
+	}
 
-		// Set the kindConfig as the config file for Viper
-		kindConfig := viper.GetString("kindConfig")
-		if len(kindConfig) == 0 {
-			log.Fatal("Could not find kindConfig")
+	// Only show what the helm charts would change on the existing cluster
+	if diffOnly {
+		if outputFormat != outputTable {
+			log.Fatalf("--diff-only can't be used with --output %s", outputFormat)
 		}
-		if err := viper.ReadConfig(bytes.NewBuffer([]byte(kindConfig))); err != nil {
+		if err := diffCluster(s.clusterName, bkc.HelmCharts); err != nil {
 			log.Fatal(err)
 		}
+		return nil
+	}
 
-		// Check to see if workers are being used. This is used to label the workers as such. This is based on inspecting the kindConfig
-		var usesWorkers bool = false
-		if len(viper.GetStringSlice("nodes")) > 1 {
-			usesWorkers = true
-		}
-
-		// Check to see if the cluster name is set in the config file
-		if viper.GetString("name") != "" {
-			clusterName = viper.GetString("name")
-		}
-
-		// Set config file back to default for Viper
-		viper.SetConfigFile(cfgFile)
-		viper.ReadInConfig()
-
-		// Try and start the kind cluster
-		err = kind.CreateKindCluster(clusterName, KindImageVersion)
+	// Anything other than a full run needs the cluster to already be there
+	partial := resume || fromStep != "" || len(only) != 0
+	exists := false
+	if partial {
+		exists, err = clusterExists(s.clusterName)
 		if err != nil {
 			log.Fatal(err)
 		}
+	}
 
-		// Get the client from the new Kubernetes clusters
-		client, err := utils.NewClient("")
-		if err != nil {
+	// When resuming, get the steps that already completed on the cluster. If
+	// the cluster isn't there we have to start from the beginning.
+	if resume && exists {
+		if err := s.loadCompleted(); err != nil {
 			log.Fatal(err)
 		}
+	}
 
-		// If not a single node then label the workers as such
-		if usesWorkers {
-			log.Info("Labeling workers")
-			err = utils.LabelWorkers(client)
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
-
-		// Load images into the cluster
-		// TODO: look into LookupEnv instead? Not sure what's better here
-		if len(dockerImages) > 0 && os.Getenv("KIND_EXPERIMENTAL_PROVIDER") == "" {
-			log.Info("Loading Images in KIND cluster")
-			if err := kind.LoadDockerImage(dockerImages, clusterName, pullImages); err != nil {
-				log.Fatal(err)
-			}
-		} else if len(dockerImages) > 0 {
-			log.Warn("KIND_EXPERIMENTAL_PROVIDER is set, image loading only works with \"docker\" - skipping image load")
-		}
+	steps, err := selectSteps(startSteps(), fromStep, only, resume, s.completed)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		// Grab HelmCharts provided in the config file
-		// Read YAML file directly to preserve key case sensitivity
-		configFileToRead := cfgFile
-		if configFileToRead == "" {
-			// If no config file was specified via flag, check if viper loaded one
-			configFileToRead = viper.ConfigFileUsed()
+	// Only show what would be done
+	if dryRun {
+		if outputFormat != outputTable {
+			return newPlan(s, steps)
 		}
+		printPlan(s, steps)
+		return nil
+	}
 
-		if configFileToRead != "" && viper.IsSet("helmCharts") {
-			yamlData, err := os.ReadFile(configFileToRead)
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			// Parse just the helmCharts section to preserve case
-			var config struct {
-				HelmCharts []struct {
-					Url          string                 `yaml:"url"`
-					Repo         string                 `yaml:"repo"`
-					Chart        string                 `yaml:"chart"`
-					Release      string                 `yaml:"release"`
-					Namespace    string                 `yaml:"namespace"`
-					ValuesObject map[string]interface{} `yaml:"valuesObject"`
-					Wait         bool                   `yaml:"wait"`
-					Version      string                 `yaml:"version"`
-				} `yaml:"helmCharts"`
-			}
+	if len(steps) == 0 {
+		log.Infof("All steps have already completed for KIND cluster %s", s.clusterName)
+		return nil
+	}
 
-			err = yaml.Unmarshal(yamlData, &config)
-			if err != nil {
-				log.Fatal(err)
-			}
+	if partial && !exists && steps[0].Name != "cluster" {
+		log.Fatalf("KIND cluster %s does not exist, run without --from-step/--only to create it", s.clusterName)
+	}
 
-			// Convert to our HC format
-			for _, chart := range config.HelmCharts {
-				// Convert valuesObject from map[interface{}]interface{} to map[string]interface{}
-				convertedValues := make(map[string]interface{})
-				for k, v := range chart.ValuesObject {
-					convertedValues[k] = convertMapInterface(v)
-				}
-
-				HC = append(HC, struct {
-					Url          string
-					Repo         string
-					Chart        string
-					Release      string
-					Namespace    string
-					ValuesObject map[string]interface{}
-					Wait         bool
-					Version      string
-				}{
-					Url:          chart.Url,
-					Repo:         chart.Repo,
-					Chart:        chart.Chart,
-					Release:      chart.Release,
-					Namespace:    chart.Namespace,
-					ValuesObject: convertedValues,
-					Wait:         chart.Wait,
-					Version:      chart.Version,
-				})
-			}
+	// Steps completed on an older cluster don't count for a new one
+	if steps[0].Name == "cluster" {
+		s.completed = nil
+	} else if !resume {
+		if err := s.loadCompleted(); err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		// Special conditions for Argo CD
-		var argoSecret *v1.Secret
-		var argoIngress *networkingv1.Ingress
-		var argoUrl string
-		var argoPass string
-
-		// Install Helm Charts if any exist in the config file
-		if len(HC) != 0 {
-			// Range over the helmCharts and try to install them
-			// 	TODO: Currently it's garbage in garbage out, if the user provides a bad chart it will fail
-			for _, v := range HC {
-				// Install HelmChart
-				log.Infof("Installing Helm Chart %s/%s from %s", v.Repo, v.Chart, v.Url)
-
-				if err := helm.Install(v.Namespace, v.Url, v.Repo, v.Chart, v.Release, v.Version, v.Wait, v.ValuesObject); err != nil {
-					log.Fatal(err)
-				}
-
-				// Special conditions apply for Argo CD
-				if v.Chart == "argo-cd" {
-
-					// Get argo password
-					argoSecret, err = client.CoreV1().Secrets("argocd").Get(context.TODO(), "argocd-initial-admin-secret", metav1.GetOptions{})
-					if err != nil {
-						if k8serrors.IsNotFound(err) {
-							argoSecret.Data = map[string][]byte{
-								"password": []byte("~* provided in helm chart *~"),
-							}
-						} else {
-							log.Fatal(err)
-						}
-					}
-
-					// Get argo ingress
-					argoIngress, err = client.NetworkingV1().Ingresses("argocd").Get(context.TODO(), "argocd-server", metav1.GetOptions{})
-					if err != nil {
-						if k8serrors.IsNotFound(err) {
-							// Try to get HTTPRoute instead
-							log.Info("Ingress not found, trying HTTPRoute")
-
-							// Get rest config for dynamic client
-							restConfig, err := utils.GetRestConfig("")
-							if err != nil {
-								log.Fatal(err)
-							}
-
-							// Create dynamic client
-							dynamicClient, err := dynamic.NewForConfig(restConfig)
-							if err != nil {
-								log.Fatal(err)
-							}
-
-							httpRouteGVR := schema.GroupVersionResource{
-								Group:    "gateway.networking.k8s.io",
-								Version:  "v1",
-								Resource: "httproutes",
-							}
-							httpRoute, err := dynamicClient.Resource(httpRouteGVR).Namespace("argocd").Get(context.TODO(), "argocd-server", metav1.GetOptions{})
-							if err != nil {
-								log.Fatal(err)
-							}
-							// Extract hostname from HTTPRoute
-							hostnames, found, err := unstructured.NestedStringSlice(httpRoute.Object, "spec", "hostnames")
-							if err != nil || !found || len(hostnames) == 0 {
-								log.Fatal("Could not extract hostnames from HTTPRoute")
-							}
-							argoUrl = fmt.Sprintf("https://%s", hostnames[0])
-						} else {
-							log.Fatal(err)
-						}
-					} else {
-						// Save information for later use from Ingress
-						argoUrl = fmt.Sprintf("https://%s", argoIngress.Spec.Rules[0].Host)
-					}
-
-					// Save information for later use
-					argoPass = string(argoSecret.Data["password"])
-
-				}
+	log.Info("Starting KIND cluster")
 
-			}
-		}
+	// Leaving this here although not using "domain" anymore, it might
+	// be useful in the future.
+	if bkc.Domain != config.DefaultDomain {
+		log.Warn("Using custom domain")
+	}
 
-		// Set up a restconfig
-		rc, err := utils.GetRestConfig("")
-		if err != nil {
+	for _, st := range steps {
+		log.Debugf("Running step %q", st.Name)
+		if err := st.Run(s); err != nil {
+			log.Errorf("Step %q failed, fix the problem and re-run with --resume to continue from it", st.Name)
 			log.Fatal(err)
 		}
 
-		// Load manifests into the cluster (if any)
-		if len(postInstallManifests) != 0 {
-			log.Info("Post Deployment Manifests")
-			if err := utils.PostInstallManifests(postInstallManifests, context.TODO(), rc); err != nil {
-				log.Warn("Issue with Post Install Manifests: ", err)
-			}
+		// Record the step so a re-run with --resume can skip it
+		if err := s.markCompleted(st.Name); err != nil {
+			log.Warnf("Could not record step %q as completed: %v", st.Name, err)
 		}
+	}
 
-		// Execute post install actions (if any)
-		if len(postInstallActions) != 0 {
-			log.Info("Post Install Actions")
-			if err := utils.PostInstallActions(postInstallActions, context.TODO(), rc); err != nil {
-				log.Warn("Issue with Post Install Actions: ", err)
-			}
-		}
+	log.Infof("KIND cluster %s is ready", s.clusterName)
 
-		// Save the bekind config to a secret
-		log.Info("Saving bekind config to a secret in \"kube-public\"")
-		err = utils.SaveBeKindConfig(rc, context.TODO(), "kube-public", "bekind-config")
-		if err != nil {
-			log.Fatal(err)
-		}
+	// Display the outputs of the charts and the config, like the Argo CD URL and password
+	// A nil *startResult has to be returned as a plain nil
+	if r := showOutputs(s); r != nil {
+		return r
+	}
+	return nil
+}
+
+// clusterExists checks if there is a KIND cluster with the given name
+func clusterExists(name string) (bool, error) {
+	clusters, err := kind.ListKindClusters()
+	if err != nil {
+		return false, err
+	}
 
-		// Display Argo CD URL and password if it exists
-		if argoUrl != "" {
-			log.Infof("Argo CD is available at %s username: admin password: %s", argoUrl, argoPass)
-		} else {
-			log.Infof("KIND cluster %s is ready", clusterName)
+	return slices.Contains(clusters, name), nil
+}
 
-		}
-	},
+// addStartFlags adds the flags used by startCluster to the given command
+func addStartFlags(cmd *cobra.Command) {
+	stepList := strings.Join(stepNames(startSteps()), ", ")
+
+	cmd.Flags().Bool("dry-run", false, "Print the steps that would be taken without running them")
+	cmd.Flags().Bool("resume", false, "Skip the steps that already completed on the existing cluster")
+	cmd.Flags().String("from-step", "", "Run the steps starting with this one against the existing cluster ("+stepList+")")
+	cmd.Flags().StringSlice("only", nil, "Only run these steps against the existing cluster ("+stepList+")")
+	cmd.Flags().Bool("diff-only", false, "Only show what installing the Helm charts would change on the existing cluster")
+	cmd.Flags().Bool("offline", false, "Install the Helm charts from the chart cache filled by \"bekind prefetch\"")
+	cmd.MarkFlagsMutuallyExclusive("resume", "from-step", "only", "diff-only")
+	cmd.MarkFlagsMutuallyExclusive("dry-run", "diff-only")
 }
 
 func init() {
 	rootCmd.AddCommand(startCmd)
+
+	addStartFlags(startCmd)
 }
@@ -0,0 +1,673 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/christianh814/bekind/pkg/config"
+	"github.com/christianh814/bekind/pkg/helm"
+	"github.com/christianh814/bekind/pkg/kind"
+	"github.com/christianh814/bekind/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	kindDefaults "sigs.k8s.io/kind/pkg/apis/config/defaults"
+)
+
+// step is a single stage of the start pipeline. Plan describes what the step would do
+// without touching docker or the cluster, Run does it.
+type step struct {
+	Name        string
+	Description string
+	Plan        func(s *startState) []string
+	Run         func(s *startState) error
+}
+
+// startState is what is shared between the steps of the start pipeline
+type startState struct {
+	ctx         context.Context
+	bkc         *config.BeKindConfig
+	clusterName string
+	client      kubernetes.Interface
+	restConfig  *rest.Config
+	// kubeContext is the context of the cluster in the kubeconfig KIND writes
+	kubeContext string
+	completed   []string
+}
+
+const (
+	// stateNamespace is where the bekind config and the completed steps are saved on the cluster
+	stateNamespace = "kube-public"
+
+	// stepsConfigMap is the name of the ConfigMap the completed steps are recorded in
+	stepsConfigMap = "bekind-steps"
+)
+
+// loadCompleted reads the steps recorded as completed on the cluster
+func (s *startState) loadCompleted() error {
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	completed, err := utils.GetCompletedSteps(s.client, s.ctx, stateNamespace, stepsConfigMap)
+	if err != nil {
+		return err
+	}
+
+	s.completed = completed
+	return nil
+}
+
+// markCompleted records the step as completed on the cluster
+func (s *startState) markCompleted(name string) error {
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	if !slices.Contains(s.completed, name) {
+		s.completed = append(s.completed, name)
+	}
+
+	return utils.SaveCompletedSteps(s.client, s.ctx, stateNamespace, stepsConfigMap, s.completed)
+}
+
+// connect sets up the Kubernetes clients for the KIND cluster, if they aren't already. The
+// clients always talk to the cluster being started, whatever the current context is.
+func (s *startState) connect() error {
+	if s.client != nil {
+		return nil
+	}
+
+	rc, kubeContext, err := kind.RestConfig(s.clusterName)
+	if err != nil {
+		return err
+	}
+
+	client, err := kubernetes.NewForConfig(rc)
+	if err != nil {
+		return err
+	}
+
+	s.restConfig = rc
+	s.kubeContext = kubeContext
+	s.client = client
+	return nil
+}
+
+// startSteps returns the steps of the start pipeline in the order they run
+func startSteps() []step {
+	return []step{
+		{
+			Name:        "cluster",
+			Description: "Create the KIND cluster",
+			Plan:        planCluster,
+			Run:         runCluster,
+		},
+		{
+			Name:        "registry",
+			Description: "Start the local registry and registry mirrors and point the nodes at them",
+			Plan:        planRegistry,
+			Run:         runRegistry,
+		},
+		{
+			Name:        "workers",
+			Description: "Label the worker nodes",
+			Plan:        planWorkers,
+			Run:         runWorkers,
+		},
+		{
+			Name:        "images",
+			Description: "Load images into the cluster nodes",
+			Plan:        planImages,
+			Run:         runImages,
+		},
+		{
+			Name:        "helm",
+			Description: "Install Helm charts",
+			Plan:        planHelm,
+			Run:         runHelm,
+		},
+		{
+			Name:        "manifests",
+			Description: "Apply post install manifests",
+			Plan:        planManifests,
+			Run:         runManifests,
+		},
+		{
+			Name:        "actions",
+			Description: "Run post install actions",
+			Plan:        planActions,
+			Run:         runActions,
+		},
+		{
+			Name:        "save-config",
+			Description: "Save the bekind config to a secret in \"" + stateNamespace + "\"",
+			Plan:        planSaveConfig,
+			Run:         runSaveConfig,
+		},
+	}
+}
+
+// stepNames returns the names of the given steps
+func stepNames(steps []step) []string {
+	var names []string
+	for _, st := range steps {
+		names = append(names, st.Name)
+	}
+
+	return names
+}
+
+// selectSteps returns the steps to run. With fromStep the pipeline starts at that step, with
+// only just the named steps are run, and with resume the completed steps are skipped.
+func selectSteps(steps []step, fromStep string, only []string, resume bool, completed []string) ([]step, error) {
+	names := stepNames(steps)
+	for _, name := range append([]string{fromStep}, only...) {
+		if name != "" && !slices.Contains(names, name) {
+			return nil, fmt.Errorf("unknown step %q, valid steps are: %s", name, strings.Join(names, ", "))
+		}
+	}
+
+	var selected []step
+	started := fromStep == ""
+	for _, st := range steps {
+		if st.Name == fromStep {
+			started = true
+		}
+		if !started {
+			continue
+		}
+		if len(only) != 0 && !slices.Contains(only, st.Name) {
+			continue
+		}
+		if resume && slices.Contains(completed, st.Name) {
+			continue
+		}
+		selected = append(selected, st)
+	}
+
+	return selected, nil
+}
+
+// printPlan prints the ordered plan of the start pipeline
+func printPlan(s *startState, steps []step) {
+	fmt.Printf("Plan for KIND cluster %q\n", s.clusterName)
+	for i, st := range steps {
+		fmt.Printf("\n%d. %s: %s\n", i+1, st.Name, st.Description)
+		for _, line := range st.Plan(s) {
+			fmt.Printf("   %s\n", line)
+		}
+	}
+}
+
+// planStep is a step of the plan, as --dry-run prints it with --output json or yaml
+type planStep struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description" yaml:"description"`
+	Plan        []string `json:"plan" yaml:"plan"`
+}
+
+// startPlan is the plan of the start pipeline for a cluster
+type startPlan struct {
+	Name  string     `json:"name" yaml:"name"`
+	Steps []planStep `json:"steps" yaml:"steps"`
+}
+
+// newPlan returns the plan of the start pipeline, like printPlan prints it
+func newPlan(s *startState, steps []step) startPlan {
+	p := startPlan{Name: s.clusterName, Steps: []planStep{}}
+	for _, st := range steps {
+		p.Steps = append(p.Steps, planStep{Name: st.Name, Description: st.Description, Plan: st.Plan(s)})
+	}
+
+	return p
+}
+
+func planCluster(s *startState) []string {
+	image := s.bkc.KindImageVersion
+	if image == "" {
+		image = kindDefaults.Image
+	}
+
+	return []string{
+		fmt.Sprintf("name: %s", s.clusterName),
+		fmt.Sprintf("node image: %s", image),
+		fmt.Sprintf("nodes: %d", s.bkc.NodeCount()),
+	}
+}
+
+func runCluster(s *startState) error {
+	if s.bkc.KindImageVersion != "" {
+		log.Warn("Using custom KIND node image " + s.bkc.KindImageVersion)
+	} else {
+		log.Info("Using default KIND node image")
+	}
+
+	// Try and start the kind cluster
+	return kind.CreateKindCluster(s.clusterName, s.bkc)
+}
+
+func planRegistry(s *startState) []string {
+	r := s.bkc.LocalRegistry
+	if r == nil && len(s.bkc.RegistryMirrors) == 0 {
+		return []string{"no local registry or registry mirrors"}
+	}
+
+	var lines []string
+	if r != nil {
+		lines = append(lines,
+			fmt.Sprintf("container: %s (%s)", r.ContainerName(), r.ContainerImage()),
+			fmt.Sprintf("push to: %s", r.Host()),
+			"configmap "+stateNamespace+"/local-registry-hosting",
+		)
+	}
+	for _, m := range s.bkc.RegistryMirrors {
+		lines = append(lines, fmt.Sprintf("mirror %s: %s (%s) caching %s", m.Registry, m.ContainerName(), m.ContainerImage(), m.RemoteURL()))
+	}
+
+	return lines
+}
+
+func runRegistry(s *startState) error {
+	for _, m := range s.bkc.RegistryMirrors {
+		log.Infof("Starting registry mirror %s for %s", m.ContainerName(), m.Registry)
+		if err := kind.StartRegistryMirror(m); err != nil {
+			return err
+		}
+	}
+
+	r := s.bkc.LocalRegistry
+	if r != nil {
+		log.Infof("Starting local registry %s on %s", r.ContainerName(), r.Host())
+		if err := kind.StartLocalRegistry(r); err != nil {
+			return err
+		}
+	}
+
+	if err := kind.ConfigureRegistries(s.clusterName, s.bkc); err != nil {
+		return err
+	}
+	if r == nil {
+		return nil
+	}
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	// Let tools know where to push images
+	return utils.SaveLocalRegistryHosting(s.restConfig, s.ctx, stateNamespace, r.Host())
+}
+
+func planWorkers(s *startState) []string {
+	if !s.bkc.UsesWorkers() {
+		return []string{"single node cluster, nothing to label"}
+	}
+
+	return []string{"label non control-plane nodes with node-role.kubernetes.io/worker"}
+}
+
+func runWorkers(s *startState) error {
+	// If not a single node then label the workers as such
+	if !s.bkc.UsesWorkers() {
+		return nil
+	}
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	log.Info("Labeling workers")
+	return utils.LabelWorkers(s.client)
+}
+
+func planImages(s *startState) []string {
+	images := s.bkc.LoadDockerImages.Images
+	if len(images) == 0 {
+		return []string{"no images to load"}
+	}
+
+	var lines []string
+	if kind.Images.Name() != "docker" {
+		lines = append(lines, fmt.Sprintf("images are loaded from %s", kind.Images.Name()))
+	}
+
+	verb := "load"
+	if s.bkc.LoadDockerImages.PullImages {
+		verb = "pull and load"
+	}
+	for _, image := range images {
+		nodes := "all nodes"
+		if len(image.Nodes) != 0 {
+			nodes = strings.Join(image.Nodes, ", ")
+		}
+		// Images from disk are never pulled
+		if image.IsFile() {
+			lines = append(lines, fmt.Sprintf("load %s from disk onto %s", image.Path(), nodes))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %s onto %s", verb, image.Name, nodes))
+	}
+
+	return lines
+}
+
+func runImages(s *startState) error {
+	// Load images into the cluster. NOTE: Images must exist on the host FIRST.
+	dockerImages := s.bkc.LoadDockerImages.Images
+	if len(dockerImages) == 0 {
+		return nil
+	}
+
+	log.Infof("Loading Images in KIND cluster from %s", kind.Images.Name())
+	return kind.LoadDockerImage(dockerImages, s.clusterName, s.bkc.LoadDockerImages.PullImages)
+}
+
+func planHelm(s *startState) []string {
+	if len(s.bkc.HelmCharts) == 0 {
+		return []string{"no Helm charts to install"}
+	}
+
+	var lines []string
+	for _, h := range s.bkc.HelmCharts {
+		lines = append(lines, fmt.Sprintf("install or upgrade release %s in namespace %s (%s)", h.Release, h.Namespace, h.Source()))
+
+		// Resolving the chart only needs the repo, not the cluster
+		info, err := helm.Resolve(h)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("  could not resolve chart: %v", err))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("  chart: %s %s (app version %s)", info.Name, info.Version, info.AppVersion))
+		for _, o := range chartOptions(h) {
+			lines = append(lines, "  "+o)
+		}
+
+		if len(info.Values) == 0 {
+			lines = append(lines, "  values: none")
+			continue
+		}
+		vals, err := yaml.Marshal(info.Values)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("  could not marshal values: %v", err))
+			continue
+		}
+		lines = append(lines, "  values:")
+		for _, v := range strings.Split(strings.TrimRight(string(vals), "\n"), "\n") {
+			lines = append(lines, "    "+v)
+		}
+	}
+
+	return lines
+}
+
+// chartOptions returns the install options set on the chart
+func chartOptions(h config.HelmChart) []string {
+	var opts []string
+	if h.Timeout != "" {
+		opts = append(opts, "timeout: "+h.Timeout)
+	}
+	if h.ShouldWait() {
+		opts = append(opts, "wait: true")
+	}
+	for _, o := range []struct {
+		name string
+		set  bool
+	}{
+		{"atomic", h.Atomic},
+		{"waitForJobs", h.WaitForJobs},
+		{"skipCRDs", h.SkipCRDs},
+		{"disableHooks", h.DisableHooks},
+	} {
+		if o.set {
+			opts = append(opts, o.name+": true")
+		}
+	}
+	if !h.ShouldCreateNamespace() {
+		opts = append(opts, "createNamespace: false")
+	}
+	if len(h.DependsOn) != 0 {
+		opts = append(opts, "dependsOn: "+strings.Join(h.DependsOn, ", "))
+	}
+	if h.Verify {
+		opts = append(opts, "verify: "+h.KeyringPath())
+	}
+	if h.Digest != "" {
+		opts = append(opts, "digest: "+h.Digest)
+	}
+	if pr := h.PostRenderer; pr != nil {
+		var renderers []string
+		if len(pr.Patches) != 0 {
+			renderers = append(renderers, fmt.Sprintf("%d patches", len(pr.Patches)))
+		}
+		if pr.Exec != "" {
+			renderers = append(renderers, "exec "+strings.Join(append([]string{pr.Exec}, pr.Args...), " "))
+		}
+		opts = append(opts, "postRenderer: "+strings.Join(renderers, ", then "))
+	}
+	var outputs []string
+	for _, o := range h.ChartOutputs() {
+		if !slices.Contains(outputs, o.Name) {
+			outputs = append(outputs, o.Name)
+		}
+	}
+	if len(outputs) != 0 {
+		opts = append(opts, "outputs: "+strings.Join(outputs, ", "))
+	}
+
+	return opts
+}
+
+func runHelm(s *startState) error {
+	if len(s.bkc.HelmCharts) == 0 {
+		return nil
+	}
+
+	// Install the charts into the KIND cluster, not whatever the current context is
+	if err := s.connect(); err != nil {
+		return err
+	}
+	helm.KubeContext = s.kubeContext
+
+	// Install or upgrade the helmCharts, each one once the charts it depends on are done
+	// 	TODO: Currently it's garbage in garbage out, if the user provides a bad chart it will fail
+	results := make([]*helm.Result, len(s.bkc.HelmCharts))
+	defer func() {
+		// Summarize what was done with each release, even if some of them failed
+		for _, r := range results {
+			if r != nil {
+				log.Info(r.String())
+			}
+		}
+	}()
+
+	return installCharts(s.bkc.HelmCharts, func(i int, v config.HelmChart) error {
+		// Install HelmChart
+		log.Infof("Installing Helm Chart %s", v.Source())
+
+		result, err := helm.Install(v)
+		if err != nil {
+			return err
+		}
+		results[i] = result
+
+		return nil
+	})
+}
+
+// installCharts calls install for each chart as soon as the charts it depends on are installed,
+// so charts that don't depend on each other are installed at the same time. Charts that depend
+// on a chart that failed are skipped. If no chart uses dependsOn, they are installed one after
+// the other in the order they are listed.
+func installCharts(charts []config.HelmChart, install func(int, config.HelmChart) error) error {
+	deps, err := config.HelmChartDependencies(charts)
+	if err != nil {
+		return err
+	}
+	inOrder := !slices.ContainsFunc(charts, func(h config.HelmChart) bool { return len(h.DependsOn) != 0 })
+	if inOrder {
+		for i := 1; i < len(charts); i++ {
+			deps[i] = []int{i - 1}
+		}
+	}
+
+	// done[i] is closed once chart i is finished, failed[i] is set before that
+	done := make([]chan struct{}, len(charts))
+	failed := make([]bool, len(charts))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for i, h := range charts {
+		wg.Add(1)
+		go func(i int, h config.HelmChart) {
+			defer wg.Done()
+			defer close(done[i])
+
+			for _, d := range deps[i] {
+				<-done[d]
+				if failed[d] {
+					// Without dependsOn the user never said the releases depend on each other
+					if inOrder {
+						log.Warnf("Skipping release %s because an earlier release failed", h.Release)
+					} else {
+						log.Warnf("Skipping release %s, it depends on release %s which failed", h.Release, charts[d].Release)
+					}
+					failed[i] = true
+					return
+				}
+			}
+
+			if err := install(i, h); err != nil {
+				failed[i] = true
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("release %s: %w", h.Release, err))
+				mu.Unlock()
+			}
+		}(i, h)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func planManifests(s *startState) []string {
+	if len(s.bkc.PostInstallManifests) == 0 {
+		return []string{"no manifests to apply"}
+	}
+
+	var lines []string
+	for _, m := range s.bkc.PostInstallManifests {
+		lines = append(lines, m)
+
+		objs, err := utils.GetManifestObjects(m)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("  could not read manifest: %v", err))
+			continue
+		}
+		for _, obj := range objs {
+			name := obj.GetName()
+			if obj.GetNamespace() != "" {
+				name = obj.GetNamespace() + "/" + name
+			}
+			lines = append(lines, fmt.Sprintf("  %s %s", obj.GetKind(), name))
+		}
+	}
+
+	return lines
+}
+
+func runManifests(s *startState) error {
+	// Load manifests into the cluster (if any). NOTE: these need to be in YAML format currently
+	// TODO: support for JSON formatted K8S Manifests
+	if len(s.bkc.PostInstallManifests) == 0 {
+		return nil
+	}
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	log.Info("Post Deployment Manifests")
+	// Fail the step so it isn't recorded as completed and --resume runs it again
+	return utils.PostInstallManifests(s.bkc.PostInstallManifests, s.ctx, s.restConfig)
+}
+
+func planActions(s *startState) []string {
+	if len(s.bkc.PostInstallActions) == 0 {
+		return []string{"no actions to run"}
+	}
+
+	var lines []string
+	for _, a := range s.bkc.PostInstallActions {
+		if err := a.Validate(); err != nil {
+			lines = append(lines, fmt.Sprintf("skip: %v", err))
+			continue
+		}
+
+		namespace := a.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		target := a.Name
+		if len(a.LabelSelector) > 0 {
+			target = fmt.Sprintf("with labels %v", a.LabelSelector)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s in namespace %s", a.Action, a.Kind, target, namespace))
+	}
+
+	return lines
+}
+
+func runActions(s *startState) error {
+	// Execute post install actions (if any)
+	if len(s.bkc.PostInstallActions) == 0 {
+		return nil
+	}
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	log.Info("Post Install Actions")
+	return utils.PostInstallActions(s.bkc.PostInstallActions, s.ctx, s.restConfig)
+}
+
+func planSaveConfig(s *startState) []string {
+	return []string{"secret " + stateNamespace + "/bekind-config"}
+}
+
+func runSaveConfig(s *startState) error {
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	// Save the bekind config to a secret
+	log.Info("Saving bekind config to a secret in \"kube-public\"")
+	return utils.SaveBeKindConfig(s.restConfig, s.ctx, stateNamespace, "bekind-config", s.bkc)
+}
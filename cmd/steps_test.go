@@ -0,0 +1,447 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/christianh814/bekind/pkg/config"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testStartState() *startState {
+	bkc := config.New()
+	bkc.KindConfig = `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+nodes:
+- role: control-plane
+- role: worker
+- role: worker
+`
+	return &startState{bkc: bkc, clusterName: "test"}
+}
+
+func TestStartSteps(t *testing.T) {
+	expected := []string{"cluster", "registry", "workers", "images", "helm", "manifests", "actions", "save-config"}
+
+	steps := startSteps()
+	if len(steps) != len(expected) {
+		t.Fatalf("Expected %d steps, got %d", len(expected), len(steps))
+	}
+
+	for i, st := range steps {
+		if st.Name != expected[i] {
+			t.Errorf("Expected step %d to be '%s', got '%s'", i, expected[i], st.Name)
+		}
+		if st.Plan == nil || st.Run == nil {
+			t.Errorf("Step '%s' should have both Plan and Run", st.Name)
+		}
+	}
+}
+
+func TestSelectSteps(t *testing.T) {
+	tests := []struct {
+		name      string
+		fromStep  string
+		only      []string
+		resume    bool
+		completed []string
+		expected  []string
+		wantErr   bool
+	}{
+		{
+			name:     "all steps",
+			expected: []string{"cluster", "registry", "workers", "images", "helm", "manifests", "actions", "save-config"},
+		},
+		{
+			name:     "from step",
+			fromStep: "manifests",
+			expected: []string{"manifests", "actions", "save-config"},
+		},
+		{
+			name:     "only",
+			only:     []string{"save-config", "helm"},
+			expected: []string{"helm", "save-config"},
+		},
+		{
+			name:      "resume",
+			resume:    true,
+			completed: []string{"cluster", "registry", "workers", "images"},
+			expected:  []string{"helm", "manifests", "actions", "save-config"},
+		},
+		{
+			name:      "resume with everything completed",
+			resume:    true,
+			completed: []string{"cluster", "registry", "workers", "images", "helm", "manifests", "actions", "save-config"},
+			expected:  nil,
+		},
+		{
+			name:      "completed ignored without resume",
+			completed: []string{"cluster"},
+			fromStep:  "actions",
+			expected:  []string{"actions", "save-config"},
+		},
+		{
+			name:     "unknown from step",
+			fromStep: "nope",
+			wantErr:  true,
+		},
+		{
+			name:    "unknown only step",
+			only:    []string{"helm", "nope"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := selectSteps(startSteps(), tt.fromStep, tt.only, tt.resume, tt.completed)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got := stepNames(steps)
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected steps %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompletedSteps(t *testing.T) {
+	s := testStartState()
+	s.ctx = context.TODO()
+	s.client = fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: stepsConfigMap, Namespace: stateNamespace},
+		Data:       map[string]string{"completed": "cluster,registry"},
+	})
+
+	if err := s.loadCompleted(); err != nil {
+		t.Fatalf("loadCompleted() returned error: %v", err)
+	}
+	if !slices.Equal(s.completed, []string{"cluster", "registry"}) {
+		t.Errorf("Expected the recorded steps, got %v", s.completed)
+	}
+
+	// New steps are added to the ones already recorded, each one once
+	for _, name := range []string{"workers", "cluster"} {
+		if err := s.markCompleted(name); err != nil {
+			t.Fatalf("markCompleted(%s) returned error: %v", name, err)
+		}
+	}
+	cm, err := s.client.CoreV1().ConfigMaps(stateNamespace).Get(s.ctx, stepsConfigMap, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get the steps ConfigMap: %v", err)
+	}
+	if cm.Data["completed"] != "cluster,registry,workers" {
+		t.Errorf("Expected completed 'cluster,registry,workers', got '%s'", cm.Data["completed"])
+	}
+}
+
+func TestPlanCluster(t *testing.T) {
+	s := testStartState()
+	s.bkc.KindImageVersion = "kindest/node:v1.34.0"
+
+	lines := strings.Join(planCluster(s), "\n")
+	for _, want := range []string{"name: test", "node image: kindest/node:v1.34.0", "nodes: 3"} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("Expected plan to contain '%s', got:\n%s", want, lines)
+		}
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	s := testStartState()
+	steps, err := selectSteps(startSteps(), "", []string{"cluster", "workers"}, false, nil)
+	if err != nil {
+		t.Fatalf("selectSteps() returned error: %v", err)
+	}
+
+	p := newPlan(s, steps)
+	if p.Name != "test" || len(p.Steps) != 2 {
+		t.Fatalf("Unexpected plan: %+v", p)
+	}
+	if p.Steps[0].Name != "cluster" || p.Steps[0].Description != "Create the KIND cluster" || !slices.Equal(p.Steps[0].Plan, planCluster(s)) {
+		t.Errorf("Unexpected cluster step: %+v", p.Steps[0])
+	}
+	if p.Steps[1].Name != "workers" || !slices.Equal(p.Steps[1].Plan, planWorkers(s)) {
+		t.Errorf("Unexpected workers step: %+v", p.Steps[1])
+	}
+}
+
+func TestPlanRegistry(t *testing.T) {
+	s := testStartState()
+	if lines := planRegistry(s); len(lines) != 1 || lines[0] != "no local registry or registry mirrors" {
+		t.Errorf("Expected no local registry, got: %v", lines)
+	}
+
+	s.bkc.LocalRegistry = &config.LocalRegistry{Port: 5005}
+	lines := planRegistry(s)
+	if len(lines) != 3 || lines[0] != "container: kind-registry (registry:2)" || lines[1] != "push to: localhost:5005" {
+		t.Errorf("Unexpected local registry plan: %v", lines)
+	}
+
+	s.bkc.RegistryMirrors = []config.RegistryMirror{{Registry: "docker.io"}}
+	lines = planRegistry(s)
+	if len(lines) != 4 || lines[3] != "mirror docker.io: kind-mirror-docker-io (registry:2) caching https://registry-1.docker.io" {
+		t.Errorf("Unexpected registry mirror plan: %v", lines)
+	}
+}
+
+func TestPlanWorkers(t *testing.T) {
+	s := testStartState()
+	if lines := planWorkers(s); !strings.Contains(lines[0], "node-role.kubernetes.io/worker") {
+		t.Errorf("Expected workers to be labeled, got: %v", lines)
+	}
+
+	s.bkc.KindConfig = "kind: Cluster\napiVersion: kind.x-k8s.io/v1alpha4\n"
+	if lines := planWorkers(s); !strings.Contains(lines[0], "nothing to label") {
+		t.Errorf("Expected nothing to label for a single node, got: %v", lines)
+	}
+}
+
+func TestPlanImages(t *testing.T) {
+	t.Setenv("KIND_EXPERIMENTAL_PROVIDER", "")
+
+	s := testStartState()
+	if lines := planImages(s); len(lines) != 1 || lines[0] != "no images to load" {
+		t.Errorf("Expected no images, got: %v", lines)
+	}
+
+	s.bkc.LoadDockerImages.Images = []config.Image{{Name: "nginx:1.25"}, {Name: "redis:7", Nodes: []string{"worker"}}}
+	lines := planImages(s)
+	if len(lines) != 2 || lines[0] != "pull and load nginx:1.25 onto all nodes" {
+		t.Errorf("Expected images to be pulled and loaded, got: %v", lines)
+	}
+	if lines[1] != "pull and load redis:7 onto worker" {
+		t.Errorf("Expected image to be loaded onto workers, got: %v", lines)
+	}
+
+	s.bkc.LoadDockerImages.Images = append(s.bkc.LoadDockerImages.Images, config.Image{Name: "archive:///tmp/app.tar"})
+	if lines := planImages(s); lines[2] != "load /tmp/app.tar from disk onto all nodes" {
+		t.Errorf("Expected archive to be loaded from disk, got: %v", lines)
+	}
+
+	s.bkc.LoadDockerImages.PullImages = false
+	if lines := planImages(s); lines[0] != "load nginx:1.25 onto all nodes" {
+		t.Errorf("Expected images to only be loaded, got: %v", lines)
+	}
+}
+
+func TestChartOptions(t *testing.T) {
+	if opts := chartOptions(config.HelmChart{}); len(opts) != 0 {
+		t.Errorf("Expected no options by default, got: %v", opts)
+	}
+
+	createNamespace := false
+	h := config.HelmChart{
+		Timeout:         "10m",
+		Atomic:          true,
+		SkipCRDs:        true,
+		CreateNamespace: &createNamespace,
+		DependsOn:       []string{"cert-manager", "ingress"},
+		PostRenderer: &config.PostRenderer{
+			Patches: []config.PostRenderPatch{{Patch: "kind: Job"}, {Path: "/patches/job.yaml"}},
+			Exec:    "renderer",
+			Args:    []string{"--env", "dev"},
+		},
+		Verify:  true,
+		Keyring: "/keys/pubring.gpg",
+		Digest:  "sha256:abc",
+		Outputs: []config.Output{{Name: "url", Ingress: "web"}, {Name: "url", HTTPRoute: "web"}, {Name: "token", Secret: "web", Key: "token"}},
+	}
+	expected := []string{"timeout: 10m", "wait: true", "atomic: true", "skipCRDs: true", "createNamespace: false", "dependsOn: cert-manager, ingress", "verify: /keys/pubring.gpg", "digest: sha256:abc", "postRenderer: 2 patches, then exec renderer --env dev", "outputs: url, token"}
+	if opts := chartOptions(h); strings.Join(opts, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected options %v, got: %v", expected, opts)
+	}
+}
+
+func TestInstallCharts(t *testing.T) {
+	charts := []config.HelmChart{
+		{Release: "argocd", DependsOn: []string{"cert-manager", "ingress"}},
+		{Release: "cert-manager"},
+		{Release: "ingress", DependsOn: []string{"cert-manager"}},
+		{Release: "monitoring"},
+	}
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	err := installCharts(charts, func(i int, h config.HelmChart) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, h.Release)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(order) != len(charts) {
+		t.Fatalf("Expected %d charts to be installed, got %v", len(charts), order)
+	}
+
+	// Each chart has to come after the charts it depends on
+	position := make(map[string]int)
+	for i, r := range order {
+		position[r] = i
+	}
+	for _, h := range charts {
+		for _, d := range h.DependsOn {
+			if position[d] > position[h.Release] {
+				t.Errorf("Expected %s to be installed before %s, got %v", d, h.Release, order)
+			}
+		}
+	}
+}
+
+func TestInstallChartsInOrder(t *testing.T) {
+	charts := []config.HelmChart{{Release: "c"}, {Release: "a"}, {Release: "b"}}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	var order []string
+	err := installCharts(charts, func(i int, h config.HelmChart) error {
+		order = append(order, h.Release)
+		if h.Release == "a" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+
+	// Without dependsOn charts go in file order and stop at the first failure
+	if strings.Join(order, ",") != "c,a" {
+		t.Errorf("Expected charts to be installed in order, got %v", order)
+	}
+
+	// The skipped chart isn't said to depend on the one that failed
+	if !strings.Contains(logs.String(), "Skipping release b because an earlier release failed") || strings.Contains(logs.String(), "depends on") {
+		t.Errorf("Unexpected log for the skipped chart:\n%s", logs.String())
+	}
+}
+
+func TestInstallChartsFailure(t *testing.T) {
+	charts := []config.HelmChart{
+		{Release: "cert-manager"},
+		{Release: "monitoring"},
+		{Release: "ingress", DependsOn: []string{"cert-manager"}},
+	}
+
+	var (
+		mu        sync.Mutex
+		installed []string
+	)
+	err := installCharts(charts, func(i int, h config.HelmChart) error {
+		if h.Release == "cert-manager" {
+			return errors.New("boom")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		installed = append(installed, h.Release)
+		return nil
+	})
+	if err == nil || err.Error() != "release cert-manager: boom" {
+		t.Errorf("Expected cert-manager to fail, got %v", err)
+	}
+
+	// Charts that depend on the failed chart are skipped, the others still get installed
+	if strings.Join(installed, ",") != "monitoring" {
+		t.Errorf("Expected only monitoring to be installed, got %v", installed)
+	}
+}
+
+func TestInstallChartsCycle(t *testing.T) {
+	charts := []config.HelmChart{
+		{Release: "a", DependsOn: []string{"b"}},
+		{Release: "b", DependsOn: []string{"a"}},
+	}
+
+	err := installCharts(charts, func(i int, h config.HelmChart) error {
+		t.Errorf("Did not expect %s to be installed", h.Release)
+		return nil
+	})
+	if err == nil {
+		t.Error("Expected an error for a dependency cycle")
+	}
+}
+
+func TestPlanManifests(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "app.yaml")
+	data := `apiVersion: v1
+kind: Namespace
+metadata:
+  name: app
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: app
+`
+	if err := os.WriteFile(manifest, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write test manifest: %v", err)
+	}
+
+	s := testStartState()
+	s.bkc.PostInstallManifests = []string{"file://" + manifest}
+
+	lines := planManifests(s)
+	expected := []string{"file://" + manifest, "  Namespace app", "  Deployment app/web"}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected plan:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+}
+
+func TestPlanActions(t *testing.T) {
+	s := testStartState()
+	s.bkc.PostInstallActions = []config.PostInstallAction{
+		{Action: "restart", Kind: "Deployment", Name: "web", Namespace: "app"},
+		{Action: "delete", Kind: "Deployment", Name: "web"},
+	}
+
+	lines := planActions(s)
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got: %v", lines)
+	}
+	if lines[0] != "restart Deployment web in namespace app" {
+		t.Errorf("Unexpected plan for restart: %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "skip: ") {
+		t.Errorf("Expected unsupported action to be skipped, got: %s", lines[1])
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2026 Christian Hernandez <christian@chernand.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/christianh814/bekind/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate [profile]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Validates a config file or profile",
+	Long: `Validates the config file that will be used by bekind, or every YAML file in
+the given profile, without creating a cluster.
+
+All problems found are reported at once in "file:line: message" format, and the
+command exits non-zero if there are any. For example:
+
+	bekind validate --config ~/.bekind/config.yaml
+	bekind validate argocd --profile-dir /tmp`,
+	ValidArgsFunction: profileValidArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var configFiles []string
+
+		if len(args) == 0 {
+			// Validate the config file that "start" would use
+			configFile := viper.ConfigFileUsed()
+			if configFile == "" {
+				log.Fatal("No config file found to validate")
+			}
+			configFiles = append(configFiles, configFile)
+		} else {
+			// Look for all yaml files in the profile directory
+			var err error
+			configFiles, err = filepath.Glob(filepath.Join(ProfileDir+"/"+args[0], "*.yaml"))
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if len(configFiles) == 0 {
+				log.Fatalf("No config files found in profile directory: %s", ProfileDir+"/"+args[0])
+			}
+		}
+
+		// Collect the problems for every file before reporting
+		var problems []config.Problem
+		for _, configFile := range configFiles {
+			problems = append(problems, config.LintFile(configFile)...)
+		}
+
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, p.String())
+		}
+
+		if len(problems) != 0 {
+			log.Fatalf("Found %d problem(s) in %d config file(s)", len(problems), len(configFiles))
+		}
+
+		log.Infof("%d config file(s) are valid", len(configFiles))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().StringVarP(&ProfileDir, "profile-dir", "p", ProfileDir, "Directory where profiles are stored")
+	validateCmd.MarkFlagsMutuallyExclusive("profile-dir", "config")
+}
@@ -0,0 +1,950 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+const (
+	// APIVersion is the current version of the bekind config schema
+	APIVersion = "bekind.chernand.io/v1alpha1"
+
+	// Kind is the kind of the bekind config
+	Kind = "BeKindConfig"
+
+	// DefaultDomain is the domain used when none is given in the config
+	DefaultDomain = "127.0.0.1.nip.io"
+
+	// DefaultRegistryName is the name of the local registry container when none is given
+	DefaultRegistryName = "kind-registry"
+
+	// DefaultRegistryPort is the port the local registry is published on when none is given
+	DefaultRegistryPort = 5001
+
+	// DefaultRegistryImage is the image the local registry runs when none is given
+	DefaultRegistryImage = "registry:2"
+
+	// DefaultHelmTimeout is how long Helm waits for Kubernetes operations when a chart doesn't say
+	DefaultHelmTimeout = 180 * time.Second
+
+	// RegistryConfigPath is where containerd on the nodes looks for registry host configs
+	RegistryConfigPath = "/etc/containerd/certs.d"
+)
+
+// BeKindConfig is the configuration file bekind uses to set up a KIND cluster
+type BeKindConfig struct {
+	APIVersion           string              `yaml:"apiVersion"`
+	Kind                 string              `yaml:"kind"`
+	Domain               string              `yaml:"domain,omitempty"`
+	KindImageVersion     string              `yaml:"kindImageVersion,omitempty"`
+	KindConfig           string              `yaml:"kindConfig,omitempty"`
+	HelmCharts           []HelmChart         `yaml:"helmCharts,omitempty"`
+	LoadDockerImages     LoadDockerImages    `yaml:"loadDockerImages,omitempty"`
+	LocalRegistry        *LocalRegistry      `yaml:"localRegistry,omitempty"`
+	RegistryMirrors      []RegistryMirror    `yaml:"registryMirrors,omitempty"`
+	PostInstallManifests []string            `yaml:"postInstallManifests,omitempty"`
+	PostInstallActions   []PostInstallAction `yaml:"postInstallActions,omitempty"`
+	Outputs              []Output            `yaml:"outputs,omitempty"`
+}
+
+// HelmChart is a Helm chart to install after the cluster is created
+type HelmChart struct {
+	Url          string                 `yaml:"url,omitempty"`
+	Repo         string                 `yaml:"repo,omitempty"`
+	Chart        string                 `yaml:"chart,omitempty"`
+	Release      string                 `yaml:"release"`
+	Namespace    string                 `yaml:"namespace"`
+	ValuesObject map[string]interface{} `yaml:"valuesObject,omitempty"`
+	Wait         bool                   `yaml:"wait,omitempty"`
+	Version      string                 `yaml:"version,omitempty"`
+	// ValuesFiles are local paths, relative to the config file, or URLs
+	ValuesFiles []string `yaml:"valuesFiles,omitempty"`
+	// Set and SetString are "key=value" pairs, as in `helm install --set`
+	Set       []string `yaml:"set,omitempty"`
+	SetString []string `yaml:"setString,omitempty"`
+	// Path is a local chart directory or packaged .tgz chart, relative to the config file.
+	// Charts with a path don't use url, repo or chart.
+	Path string `yaml:"path,omitempty"`
+	// Auth is how to log in to the chart repository or OCI registry
+	Auth *HelmAuth `yaml:"auth,omitempty"`
+	// PostRenderer changes the rendered manifests before they are installed
+	PostRenderer *PostRenderer `yaml:"postRenderer,omitempty"`
+	// Verify checks the chart's provenance file with the keyring before it's installed
+	Verify  bool   `yaml:"verify,omitempty"`
+	Keyring string `yaml:"keyring,omitempty"`
+	// Digest pins an OCI chart to a manifest digest, like "sha256:..."
+	Digest string `yaml:"digest,omitempty"`
+	// DependsOn are the releases that have to be installed before this chart
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+	// Outputs are values to show once the chart is installed, like its URL and password
+	Outputs []Output `yaml:"outputs,omitempty"`
+	// Timeout is how long to wait for Kubernetes operations, as a duration like "10m"
+	Timeout         string `yaml:"timeout,omitempty"`
+	Atomic          bool   `yaml:"atomic,omitempty"`
+	WaitForJobs     bool   `yaml:"waitForJobs,omitempty"`
+	SkipCRDs        bool   `yaml:"skipCRDs,omitempty"`
+	DisableHooks    bool   `yaml:"disableHooks,omitempty"`
+	CreateNamespace *bool  `yaml:"createNamespace,omitempty"`
+}
+
+// TimeoutDuration returns the timeout for the chart, or DefaultHelmTimeout if it isn't set
+func (h HelmChart) TimeoutDuration() (time.Duration, error) {
+	if h.Timeout == "" {
+		return DefaultHelmTimeout, nil
+	}
+
+	d, err := time.ParseDuration(h.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %w", h.Timeout, err)
+	}
+
+	return d, nil
+}
+
+// ShouldCreateNamespace returns true if Helm should create the namespace, which is the default
+func (h HelmChart) ShouldCreateNamespace() bool {
+	return h.CreateNamespace == nil || *h.CreateNamespace
+}
+
+// ShouldWait returns true if Helm should wait for the release to be ready. Atomic installs
+// and waiting for jobs both need to wait.
+func (h HelmChart) ShouldWait() bool {
+	return h.Wait || h.Atomic || h.WaitForJobs
+}
+
+// IsOCI returns true if the chart is pulled from an OCI registry
+func (h HelmChart) IsOCI() bool {
+	return strings.HasPrefix(h.Url, "oci://")
+}
+
+// IsLocal returns true if the chart is a directory or .tgz on disk
+func (h HelmChart) IsLocal() bool {
+	return h.Path != ""
+}
+
+// KeyringPath returns the keyring to verify the chart with, which is the same as Helm's
+// default if it isn't set
+func (h HelmChart) KeyringPath() string {
+	if h.Keyring == "" {
+		return filepath.Join(os.Getenv("HOME"), ".gnupg", "pubring.gpg")
+	}
+
+	return h.Keyring
+}
+
+// validDigest returns an error if d isn't a sha256 digest
+func validDigest(d string) error {
+	hex, ok := strings.CutPrefix(d, "sha256:")
+	if !ok || len(hex) != 64 || strings.Trim(hex, "0123456789abcdef") != "" {
+		return fmt.Errorf("invalid digest %q, expected sha256:<64 hex characters>", d)
+	}
+
+	return nil
+}
+
+// Source describes where the chart comes from
+func (h HelmChart) Source() string {
+	switch {
+	case h.IsLocal():
+		return h.Path
+	case h.IsOCI():
+		return h.Url
+	default:
+		return fmt.Sprintf("%s/%s from %s", h.Repo, h.Chart, h.Url)
+	}
+}
+
+// HelmAuth is how to log in to a chart repository or OCI registry. The username and password
+// are read from environment variables or files, so they don't have to be in the config.
+type HelmAuth struct {
+	UsernameEnv           string `yaml:"usernameEnv,omitempty"`
+	UsernameFile          string `yaml:"usernameFile,omitempty"`
+	PasswordEnv           string `yaml:"passwordEnv,omitempty"`
+	PasswordFile          string `yaml:"passwordFile,omitempty"`
+	CAFile                string `yaml:"caFile,omitempty"`
+	InsecureSkipTLSVerify bool   `yaml:"insecureSkipTLSVerify,omitempty"`
+}
+
+// Validate checks that each credential comes from one place, and that a password has a username
+func (a *HelmAuth) Validate() error {
+	if a.UsernameEnv != "" && a.UsernameFile != "" {
+		return errors.New("only one of usernameEnv and usernameFile can be set")
+	}
+	if a.PasswordEnv != "" && a.PasswordFile != "" {
+		return errors.New("only one of passwordEnv and passwordFile can be set")
+	}
+	if (a.PasswordEnv != "" || a.PasswordFile != "") && a.UsernameEnv == "" && a.UsernameFile == "" {
+		return errors.New("a password needs a username")
+	}
+
+	return nil
+}
+
+// Credentials returns the username and password from their environment variables or files.
+// They are empty if they aren't set.
+func (a *HelmAuth) Credentials() (username string, password string, err error) {
+	if a == nil {
+		return "", "", nil
+	}
+
+	username, err = secretValue(a.UsernameEnv, a.UsernameFile)
+	if err != nil {
+		return "", "", fmt.Errorf("username: %w", err)
+	}
+	password, err = secretValue(a.PasswordEnv, a.PasswordFile)
+	if err != nil {
+		return "", "", fmt.Errorf("password: %w", err)
+	}
+
+	return username, password, nil
+}
+
+// secretValue returns the value of the environment variable env, or the contents of file
+func secretValue(env string, file string) (string, error) {
+	switch {
+	case env != "":
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", env)
+		}
+		return v, nil
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	default:
+		return "", nil
+	}
+}
+
+// PostRenderer changes the manifests Helm renders before they are installed. Patches are
+// applied first, then the exec binary is run.
+type PostRenderer struct {
+	Patches []PostRenderPatch `yaml:"patches,omitempty"`
+	// Exec is a binary that reads the manifests on stdin and writes the changed ones to stdout
+	Exec string   `yaml:"exec,omitempty"`
+	Args []string `yaml:"args,omitempty"`
+}
+
+// PostRenderPatch is a kustomize strategic merge or JSON6902 patch, inline or from a file
+type PostRenderPatch struct {
+	Patch  string       `yaml:"patch,omitempty"`
+	Path   string       `yaml:"path,omitempty"`
+	Target *PatchTarget `yaml:"target,omitempty"`
+}
+
+// PatchTarget selects the resources a patch is applied to, like a kustomize patch target
+type PatchTarget struct {
+	Group              string `yaml:"group,omitempty"`
+	Version            string `yaml:"version,omitempty"`
+	Kind               string `yaml:"kind,omitempty"`
+	Name               string `yaml:"name,omitempty"`
+	Namespace          string `yaml:"namespace,omitempty"`
+	LabelSelector      string `yaml:"labelSelector,omitempty"`
+	AnnotationSelector string `yaml:"annotationSelector,omitempty"`
+}
+
+// Validate checks that the post renderer does something, and that each patch has one source
+func (r *PostRenderer) Validate() error {
+	if len(r.Patches) == 0 && r.Exec == "" {
+		return errors.New("patches or exec is required")
+	}
+	for i, p := range r.Patches {
+		if (p.Patch == "") == (p.Path == "") {
+			return fmt.Errorf("patches[%d]: one of patch and path is required", i)
+		}
+	}
+
+	return nil
+}
+
+// HelmChartDependencies returns the indexes of the charts each chart depends on. Charts
+// that depend on a release that isn't in the list, or on each other, are an error.
+func HelmChartDependencies(charts []HelmChart) ([][]int, error) {
+	releases := make(map[string]bool)
+	for _, h := range charts {
+		releases[h.Release] = true
+	}
+	for i, h := range charts {
+		for _, r := range h.DependsOn {
+			if !releases[r] {
+				return nil, fmt.Errorf("helmCharts[%d]: dependsOn: unknown release %q", i, r)
+			}
+		}
+	}
+
+	deps := dependencyIndexes(charts)
+	if cycle := dependencyCycle(deps); cycle != nil {
+		return nil, fmt.Errorf("helmCharts[%d]: dependsOn: dependency cycle %s", cycle[0], cyclePath(charts, cycle))
+	}
+
+	return deps, nil
+}
+
+// dependencyIndexes returns the indexes of the charts each chart depends on, a release
+// can be installed by more than one chart
+func dependencyIndexes(charts []HelmChart) [][]int {
+	deps := make([][]int, len(charts))
+	for i, h := range charts {
+		for _, r := range h.DependsOn {
+			for j, d := range charts {
+				if d.Release == r {
+					deps[i] = append(deps[i], j)
+				}
+			}
+		}
+	}
+
+	return deps
+}
+
+// cyclePath returns the releases in a dependency cycle, like "a -> b -> a"
+func cyclePath(charts []HelmChart, cycle []int) string {
+	var names []string
+	for _, i := range cycle {
+		names = append(names, charts[i].Release)
+	}
+
+	return strings.Join(names, " -> ")
+}
+
+// dependencyCycle returns the first cycle found in deps as a path that starts and ends with
+// the same index, or nil if there isn't one
+func dependencyCycle(deps [][]int) []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(deps))
+
+	var path []int
+	var visit func(i int) []int
+	visit = func(i int) []int {
+		state[i] = visiting
+		path = append(path, i)
+		for _, d := range deps[i] {
+			switch state[d] {
+			case visiting:
+				// Trim the path down to the cycle
+				for k, p := range path {
+					if p == d {
+						return append(append([]int{}, path[k:]...), d)
+					}
+				}
+			case unvisited:
+				if cycle := visit(d); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+
+	for i := range deps {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadDockerImages are the images to load into the cluster nodes. NOTE: Images must exist on the host FIRST.
+type LoadDockerImages struct {
+	PullImages bool    `yaml:"pullImages"`
+	Images     []Image `yaml:"images,omitempty"`
+}
+
+const (
+	// ArchivePrefix is used for images in a tar archive on disk, as written by `docker save`
+	ArchivePrefix = "archive://"
+
+	// OCILayoutPrefix is used for images in an OCI image layout directory on disk
+	OCILayoutPrefix = "oci-layout://"
+)
+
+// Image is an image to load into the cluster. In the config it can be just the image name,
+// in which case it's loaded onto every node, or a mapping with the nodes to load it onto.
+// The name can also be an archive:// or oci-layout:// path to load the image from disk.
+type Image struct {
+	Name string `yaml:"image"`
+	// Nodes are node roles ("control-plane" or "worker") or node names
+	Nodes []string `yaml:"nodes,omitempty"`
+}
+
+// UnmarshalYAML accepts either a plain image name or an image mapping
+func (i *Image) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*i = Image{Name: name}
+		return nil
+	}
+
+	// Use a different type so we don't end up back here
+	type image Image
+	var img image
+	if err := unmarshal(&img); err != nil {
+		return err
+	}
+	*i = Image(img)
+
+	return nil
+}
+
+// MarshalYAML writes images without a node selector as just the image name
+func (i Image) MarshalYAML() (interface{}, error) {
+	if len(i.Nodes) == 0 {
+		return i.Name, nil
+	}
+
+	type image Image
+	return image(i), nil
+}
+
+// OnNode returns true if the image should be loaded onto the node with the given name and role
+func (i Image) OnNode(name string, role string) bool {
+	if len(i.Nodes) == 0 {
+		return true
+	}
+
+	for _, n := range i.Nodes {
+		if n == name || n == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsArchive returns true if the image is loaded from a tar archive on disk
+func (i Image) IsArchive() bool {
+	return strings.HasPrefix(i.Name, ArchivePrefix)
+}
+
+// IsOCILayout returns true if the image is loaded from an OCI image layout directory on disk
+func (i Image) IsOCILayout() bool {
+	return strings.HasPrefix(i.Name, OCILayoutPrefix)
+}
+
+// IsFile returns true if the image is loaded from disk instead of the local container runtime
+func (i Image) IsFile() bool {
+	return i.IsArchive() || i.IsOCILayout()
+}
+
+// Path returns the path on disk of an archive or OCI layout image
+func (i Image) Path() string {
+	return strings.TrimPrefix(strings.TrimPrefix(i.Name, ArchivePrefix), OCILayoutPrefix)
+}
+
+// Validate checks that the image has a name, and a path when it's loaded from disk
+func (i Image) Validate() error {
+	if i.Name == "" {
+		return errors.New("image is required")
+	}
+	if i.IsFile() && i.Path() == "" {
+		return fmt.Errorf("%s is missing a path", i.Name)
+	}
+
+	return nil
+}
+
+// CheckFiles checks that images loaded from disk are there
+func (i Image) CheckFiles() error {
+	switch {
+	case i.IsArchive():
+		fi, err := os.Stat(i.Path())
+		if err != nil {
+			return fmt.Errorf("archive %s: %w", i.Path(), err)
+		}
+		if fi.IsDir() {
+			return fmt.Errorf("archive %s is a directory, use %s for OCI layout directories", i.Path(), OCILayoutPrefix)
+		}
+	case i.IsOCILayout():
+		// Every OCI layout has an "oci-layout" file at the top
+		if _, err := os.Stat(filepath.Join(i.Path(), "oci-layout")); err != nil {
+			return fmt.Errorf("%s is not an OCI layout directory: %w", i.Path(), err)
+		}
+	}
+
+	return nil
+}
+
+// ImageNames returns the names of the given images
+func ImageNames(images []Image) []string {
+	names := make([]string, 0, len(images))
+	for _, i := range images {
+		names = append(names, i.Name)
+	}
+
+	return names
+}
+
+// LocalRegistry is a registry container on the kind network that the cluster nodes can pull from
+type LocalRegistry struct {
+	Name  string `yaml:"name,omitempty"`
+	Port  int    `yaml:"port,omitempty"`
+	Image string `yaml:"image,omitempty"`
+}
+
+// ContainerName returns the name of the registry container
+func (r *LocalRegistry) ContainerName() string {
+	if r.Name == "" {
+		return DefaultRegistryName
+	}
+
+	return r.Name
+}
+
+// HostPort returns the port the registry is published on, on the host
+func (r *LocalRegistry) HostPort() int {
+	if r.Port == 0 {
+		return DefaultRegistryPort
+	}
+
+	return r.Port
+}
+
+// ContainerImage returns the image the registry container runs
+func (r *LocalRegistry) ContainerImage() string {
+	if r.Image == "" {
+		return DefaultRegistryImage
+	}
+
+	return r.Image
+}
+
+// Host returns the address the registry is pushed to from the host, and pulled from in the cluster
+func (r *LocalRegistry) Host() string {
+	return fmt.Sprintf("localhost:%d", r.HostPort())
+}
+
+// HostsTOML returns the containerd host config that points the nodes at the registry container
+func (r *LocalRegistry) HostsTOML() string {
+	return fmt.Sprintf("[host.\"http://%s:5000\"]\n", r.ContainerName())
+}
+
+// RegistryMirror is a pull-through cache container for a remote registry. Mirrors are shared by
+// all clusters, so images only need to be pulled from the internet once.
+type RegistryMirror struct {
+	Registry string `yaml:"registry"`
+	Remote   string `yaml:"remote,omitempty"`
+	Name     string `yaml:"name,omitempty"`
+	Image    string `yaml:"image,omitempty"`
+}
+
+// RemoteURL returns the URL of the registry being mirrored
+func (m RegistryMirror) RemoteURL() string {
+	switch {
+	case m.Remote != "":
+		return m.Remote
+	case m.Registry == "docker.io":
+		// Docker Hub doesn't serve the registry API on docker.io itself
+		return "https://registry-1.docker.io"
+	default:
+		return "https://" + m.Registry
+	}
+}
+
+// ContainerName returns the name of the mirror container
+func (m RegistryMirror) ContainerName() string {
+	if m.Name == "" {
+		return "kind-mirror-" + strings.NewReplacer(".", "-", ":", "-").Replace(m.Registry)
+	}
+
+	return m.Name
+}
+
+// ContainerImage returns the image the mirror container runs
+func (m RegistryMirror) ContainerImage() string {
+	if m.Image == "" {
+		return DefaultRegistryImage
+	}
+
+	return m.Image
+}
+
+// HostsTOML returns the containerd host config that sends pulls through the mirror, falling
+// back to the remote registry when the mirror isn't there
+func (m RegistryMirror) HostsTOML() string {
+	return fmt.Sprintf("server = %q\n\n[host.\"http://%s:5000\"]\n  capabilities = [\"pull\", \"resolve\"]\n", m.RemoteURL(), m.ContainerName())
+}
+
+// RegistryHostsFile returns where containerd on the nodes looks for the config of the registry host
+func RegistryHostsFile(host string) string {
+	return path.Join(RegistryConfigPath, host, "hosts.toml")
+}
+
+// PostInstallAction represents an action to be executed after installation
+type PostInstallAction struct {
+	Action        string            `yaml:"action"`
+	Group         string            `yaml:"group,omitempty"`
+	Version       string            `yaml:"version,omitempty"`
+	Kind          string            `yaml:"kind"`
+	Name          string            `yaml:"name,omitempty"`
+	Namespace     string            `yaml:"namespace,omitempty"`
+	LabelSelector map[string]string `yaml:"labelSelector,omitempty"`
+}
+
+// restartKinds are the kinds that can be used with the "restart" action
+var restartKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"DaemonSet":   true,
+}
+
+// Validate checks that the action is supported for the given kind
+func (a PostInstallAction) Validate() error {
+	if a.Action == "" {
+		return errors.New("empty 'action' field")
+	}
+	if a.Kind == "" {
+		return errors.New("empty 'kind' field")
+	}
+	// Either name or labelSelector must be provided
+	if a.Name == "" && len(a.LabelSelector) == 0 {
+		return errors.New("empty 'name' and 'labelSelector' fields - at least one is required")
+	}
+
+	switch a.Action {
+	case "restart":
+		if !restartKinds[a.Kind] {
+			return fmt.Errorf("unsupported kind '%s' for restart action", a.Kind)
+		}
+	case "delete":
+		if a.Kind != "Pod" {
+			return fmt.Errorf("unsupported kind '%s' for delete action - only Pod is supported", a.Kind)
+		}
+	default:
+		return fmt.Errorf("unsupported action '%s' for %s/%s", a.Action, a.Kind, a.Name)
+	}
+
+	return nil
+}
+
+// Output is a value read from the cluster once it's ready, like a URL or a password, that is
+// shown at the end of start. It's read from one of the objects named by secret, configMap,
+// ingress, httpRoute or service.
+type Output struct {
+	Name      string `yaml:"name"`
+	Secret    string `yaml:"secret,omitempty"`
+	ConfigMap string `yaml:"configMap,omitempty"`
+	Ingress   string `yaml:"ingress,omitempty"`
+	HTTPRoute string `yaml:"httpRoute,omitempty"`
+	Service   string `yaml:"service,omitempty"`
+	// Namespace defaults to the chart's namespace, or "default" for top level outputs
+	Namespace string `yaml:"namespace,omitempty"`
+	// Key is the Secret or ConfigMap key to read
+	Key string `yaml:"key,omitempty"`
+	// Port is the name or number of the Service port to read the node port of
+	Port string `yaml:"port,omitempty"`
+	// JSONPath reads any field of the object instead, like "{.spec.rules[0].host}"
+	JSONPath string `yaml:"jsonPath,omitempty"`
+	// Format is how the value is shown, with %s replaced by the value, like "https://%s"
+	Format string `yaml:"format,omitempty"`
+}
+
+// Object returns the kind and name of the object the output is read from
+func (o Output) Object() (kind string, name string) {
+	for _, k := range []struct{ kind, name string }{
+		{"Secret", o.Secret},
+		{"ConfigMap", o.ConfigMap},
+		{"Ingress", o.Ingress},
+		{"HTTPRoute", o.HTTPRoute},
+		{"Service", o.Service},
+	} {
+		if k.name != "" {
+			return k.kind, k.name
+		}
+	}
+
+	return "", ""
+}
+
+// Validate checks that the output reads from exactly one object, with the fields that kind uses
+func (o Output) Validate() error {
+	if o.Name == "" {
+		return errors.New("name is required")
+	}
+
+	set := 0
+	for _, n := range []string{o.Secret, o.ConfigMap, o.Ingress, o.HTTPRoute, o.Service} {
+		if n != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("output %q: exactly one of secret, configMap, ingress, httpRoute and service is required", o.Name)
+	}
+
+	kind, _ := o.Object()
+	if o.Key != "" && kind != "Secret" && kind != "ConfigMap" {
+		return fmt.Errorf("output %q: key is only used with secret and configMap", o.Name)
+	}
+	if o.Key == "" && o.JSONPath == "" && (kind == "Secret" || kind == "ConfigMap") {
+		return fmt.Errorf("output %q: key or jsonPath is required for a %s", o.Name, kind)
+	}
+	if o.Port != "" && kind != "Service" {
+		return fmt.Errorf("output %q: port is only used with service", o.Name)
+	}
+	if o.JSONPath != "" {
+		if err := jsonpath.New(o.Name).Parse(o.JSONPath); err != nil {
+			return fmt.Errorf("output %q: invalid jsonPath: %w", o.Name, err)
+		}
+	}
+	if o.Format != "" && !strings.Contains(o.Format, "%s") {
+		return fmt.Errorf("output %q: format must contain %%s", o.Name)
+	}
+
+	return nil
+}
+
+// FormatValue returns the value as it's shown, using Format
+func (o Output) FormatValue(value string) string {
+	if o.Format == "" {
+		return value
+	}
+
+	return strings.Replace(o.Format, "%s", value, 1)
+}
+
+// ChartOutputs returns the chart's outputs, with their namespace defaulted to the chart's
+func (h HelmChart) ChartOutputs() []Output {
+	var out []Output
+	for _, o := range h.Outputs {
+		if o.Namespace == "" {
+			o.Namespace = h.Namespace
+		}
+		out = append(out, o)
+	}
+
+	return out
+}
+
+// ValidateManifestURL checks that a postInstallManifests entry uses a supported scheme
+func ValidateManifestURL(m string) error {
+	for _, scheme := range []string{"http://", "https://", "file://"} {
+		if strings.HasPrefix(m, scheme) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported manifest %q, only http://, https://, and file:// are supported", m)
+}
+
+// New returns a BeKindConfig with the defaults set
+func New() *BeKindConfig {
+	return &BeKindConfig{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Domain:     DefaultDomain,
+		LoadDockerImages: LoadDockerImages{
+			PullImages: true,
+		},
+	}
+}
+
+// Load reads the bekind config from the given file
+func Load(path string) (*BeKindConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Values files are relative to the config file, so profiles can keep them next to it
+	c.resolvePaths(filepath.Dir(path))
+
+	return c, nil
+}
+
+// resolvePaths makes the local paths in the config relative to dir
+func (c *BeKindConfig) resolvePaths(dir string) {
+	for i := range c.HelmCharts {
+		if p := c.HelmCharts[i].Path; p != "" {
+			c.HelmCharts[i].Path = ResolvePath(dir, p)
+		}
+		if r := c.HelmCharts[i].PostRenderer; r != nil {
+			for j, p := range r.Patches {
+				if p.Path != "" {
+					r.Patches[j].Path = ResolvePath(dir, p.Path)
+				}
+			}
+			// A bare name is looked up in the PATH
+			if strings.ContainsRune(r.Exec, filepath.Separator) {
+				r.Exec = ResolvePath(dir, r.Exec)
+			}
+		}
+		if k := c.HelmCharts[i].Keyring; k != "" {
+			c.HelmCharts[i].Keyring = ResolvePath(dir, k)
+		}
+		if a := c.HelmCharts[i].Auth; a != nil {
+			for _, f := range []*string{&a.UsernameFile, &a.PasswordFile, &a.CAFile} {
+				if *f != "" {
+					*f = ResolvePath(dir, *f)
+				}
+			}
+		}
+		for j, f := range c.HelmCharts[i].ValuesFiles {
+			c.HelmCharts[i].ValuesFiles[j] = ResolvePath(dir, f)
+		}
+	}
+}
+
+// ResolvePath returns the local path p relative to dir. URLs and absolute paths are
+// returned as they are, except file:// URLs which are returned as a path.
+func ResolvePath(dir string, p string) string {
+	p = strings.TrimPrefix(p, "file://")
+	if strings.Contains(p, "://") || filepath.IsAbs(p) {
+		return p
+	}
+
+	return filepath.Join(dir, p)
+}
+
+// Parse decodes the bekind config from YAML. Configs written before the schema was
+// versioned don't have an apiVersion/kind header, so those get the current one.
+func Parse(data []byte) (*BeKindConfig, error) {
+	// Start with the defaults, yaml only overwrites the fields that are set
+	c := New()
+	c.APIVersion = ""
+	c.Kind = ""
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+
+	if c.APIVersion == "" {
+		c.APIVersion = APIVersion
+	}
+	if c.Kind == "" {
+		c.Kind = Kind
+	}
+
+	// yaml.v2 decodes nested maps as map[interface{}]interface{}, Helm needs string keys
+	for i := range c.HelmCharts {
+		for k, v := range c.HelmCharts[i].ValuesObject {
+			c.HelmCharts[i].ValuesObject[k] = convertMapInterface(v)
+		}
+	}
+
+	return c, nil
+}
+
+// Cluster decodes the kindConfig into the KIND cluster API type
+func (c *BeKindConfig) Cluster() (*v1alpha4.Cluster, error) {
+	cluster := &v1alpha4.Cluster{}
+	if err := yaml.Unmarshal([]byte(c.KindConfig), cluster); err != nil {
+		return nil, err
+	}
+
+	return cluster, nil
+}
+
+// ClusterName returns the name set in the kindConfig, or name if it isn't set there
+func (c *BeKindConfig) ClusterName(name string) string {
+	cluster, err := c.Cluster()
+	if err == nil && cluster.Name != "" {
+		return cluster.Name
+	}
+
+	return name
+}
+
+// NodeCount returns the number of nodes in the kindConfig. KIND defaults to a single node.
+func (c *BeKindConfig) NodeCount() int {
+	cluster, err := c.Cluster()
+	if err != nil || len(cluster.Nodes) == 0 {
+		return 1
+	}
+
+	return len(cluster.Nodes)
+}
+
+// UsesWorkers returns true if the kindConfig has more than one node
+func (c *BeKindConfig) UsesWorkers() bool {
+	return c.NodeCount() > 1
+}
+
+// NodeKindConfig returns the kindConfig to create the cluster with. When the nodes need to pull
+// from a local registry or registry mirrors, containerd is patched to read the registry host configs.
+func (c *BeKindConfig) NodeKindConfig() (string, error) {
+	if c.LocalRegistry == nil && len(c.RegistryMirrors) == 0 {
+		return c.KindConfig, nil
+	}
+
+	// Use a MapSlice so the kindConfig keeps its order
+	var kc yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(c.KindConfig), &kc); err != nil {
+		return "", err
+	}
+
+	patch := fmt.Sprintf("[plugins.\"io.containerd.grpc.v1.cri\".registry]\n  config_path = \"%s\"\n", RegistryConfigPath)
+	found := false
+	for i, item := range kc {
+		if item.Key != "containerdConfigPatches" {
+			continue
+		}
+		patches, _ := item.Value.([]interface{})
+		kc[i].Value = append(patches, patch)
+		found = true
+	}
+	if !found {
+		kc = append(kc, yaml.MapItem{Key: "containerdConfigPatches", Value: []interface{}{patch}})
+	}
+
+	out, err := yaml.Marshal(kc)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// Marshal returns the config as YAML
+func (c *BeKindConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// convertMapInterface recursively converts map[interface{}]interface{} to map[string]interface{}
+func convertMapInterface(data interface{}) interface{} {
+	switch v := data.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{})
+		for key, value := range v {
+			strKey := fmt.Sprintf("%v", key)
+			result[strKey] = convertMapInterface(value)
+		}
+		return result
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = convertMapInterface(value)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertMapInterface(item)
+		}
+		return v
+	default:
+		return data
+	}
+}
@@ -0,0 +1,944 @@
+/*
+Copyright © 2022 Christian Hernandez christian@chernand.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConvertMapInterface(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    interface{}
+		expected interface{}
+	}{
+		{
+			name:     "simple string",
+			input:    "test",
+			expected: "test",
+		},
+		{
+			name:     "simple number",
+			input:    42,
+			expected: 42,
+		},
+		{
+			name: "map with interface keys",
+			input: map[interface{}]interface{}{
+				"key1": "value1",
+				"key2": 42,
+			},
+			expected: map[string]interface{}{
+				"key1": "value1",
+				"key2": 42,
+			},
+		},
+		{
+			name: "nested map",
+			input: map[interface{}]interface{}{
+				"outer": map[interface{}]interface{}{
+					"inner": "value",
+				},
+			},
+			expected: map[string]interface{}{
+				"outer": map[string]interface{}{
+					"inner": "value",
+				},
+			},
+		},
+		{
+			name: "slice with maps",
+			input: []interface{}{
+				map[interface{}]interface{}{
+					"key": "value",
+				},
+				"string",
+			},
+			expected: []interface{}{
+				map[string]interface{}{
+					"key": "value",
+				},
+				"string",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := convertMapInterface(tc.input)
+
+			// For simple types, direct comparison
+			if tc.name == "simple string" || tc.name == "simple number" {
+				if result != tc.expected {
+					t.Errorf("Expected %v, got %v", tc.expected, result)
+				}
+				return
+			}
+
+			// For complex types, we'll do basic type checking
+			switch expected := tc.expected.(type) {
+			case map[string]interface{}:
+				resultMap, ok := result.(map[string]interface{})
+				if !ok {
+					t.Errorf("Expected map[string]interface{}, got %T", result)
+					return
+				}
+
+				if len(resultMap) != len(expected) {
+					t.Errorf("Expected map length %d, got %d", len(expected), len(resultMap))
+				}
+
+				// Check that all keys are strings
+				for key := range resultMap {
+					if key == "" {
+						t.Error("Map key should not be empty")
+					}
+				}
+
+			case []interface{}:
+				resultSlice, ok := result.([]interface{})
+				if !ok {
+					t.Errorf("Expected []interface{}, got %T", result)
+					return
+				}
+
+				if len(resultSlice) != len(expected) {
+					t.Errorf("Expected slice length %d, got %d", len(expected), len(resultSlice))
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	data := []byte(`
+domain: "7f000001.nip.io"
+kindImageVersion: "kindest/node:v1.34.0"
+kindConfig: |
+  kind: Cluster
+  name: my-cluster
+  apiVersion: kind.x-k8s.io/v1alpha4
+  nodes:
+  - role: control-plane
+  - role: worker
+helmCharts:
+  - url: "https://kubernetes.github.io/ingress-nginx"
+    repo: "ingress-nginx"
+    chart: "ingress-nginx"
+    release: "nginx-ingress"
+    namespace: "ingress-controller"
+    valuesObject:
+      controller:
+        hostNetwork: true
+        extraArgs:
+          enableSSLPassthrough: true
+loadDockerImages:
+  pullImages: false
+  images:
+    - gcr.io/kuar-demo/kuard-amd64:blue
+    - image: quay.io/christianh814/simple-go:latest
+      nodes:
+        - worker
+`)
+
+	c, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+
+	// Configs without a header get the current one
+	if c.APIVersion != APIVersion || c.Kind != Kind {
+		t.Errorf("Expected header %s/%s, got %s/%s", APIVersion, Kind, c.APIVersion, c.Kind)
+	}
+
+	if c.Domain != "7f000001.nip.io" {
+		t.Errorf("Expected domain '7f000001.nip.io', got '%s'", c.Domain)
+	}
+
+	if c.LoadDockerImages.PullImages {
+		t.Error("pullImages should be false when set to false in the config")
+	}
+
+	// Images can be given as just a name or with the nodes to load them onto
+	images := c.LoadDockerImages.Images
+	if len(images) != 2 {
+		t.Fatalf("Expected 2 images, got %d", len(images))
+	}
+	if images[0].Name != "gcr.io/kuar-demo/kuard-amd64:blue" || len(images[0].Nodes) != 0 {
+		t.Errorf("Expected plain image without nodes, got %+v", images[0])
+	}
+	if images[1].Name != "quay.io/christianh814/simple-go:latest" || len(images[1].Nodes) != 1 || images[1].Nodes[0] != "worker" {
+		t.Errorf("Expected image with worker nodes, got %+v", images[1])
+	}
+
+	if len(c.HelmCharts) != 1 {
+		t.Fatalf("Expected 1 helm chart, got %d", len(c.HelmCharts))
+	}
+
+	// Nested values should have string keys and keep their case
+	controller, ok := c.HelmCharts[0].ValuesObject["controller"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected map[string]interface{}, got %T", c.HelmCharts[0].ValuesObject["controller"])
+	}
+	if _, ok := controller["hostNetwork"]; !ok {
+		t.Error("Expected key 'hostNetwork' to keep its case")
+	}
+	if _, ok := controller["extraArgs"].(map[string]interface{}); !ok {
+		t.Errorf("Expected nested map[string]interface{}, got %T", controller["extraArgs"])
+	}
+
+	if c.ClusterName("kind") != "my-cluster" {
+		t.Errorf("Expected cluster name 'my-cluster', got '%s'", c.ClusterName("kind"))
+	}
+
+	if c.NodeCount() != 2 || !c.UsesWorkers() {
+		t.Errorf("Expected 2 nodes with workers, got %d", c.NodeCount())
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() returned error: %v", err)
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	c, err := Parse([]byte(`kindImageVersion: "kindest/node:v1.34.0"`))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+
+	if c.Domain != DefaultDomain {
+		t.Errorf("Expected default domain '%s', got '%s'", DefaultDomain, c.Domain)
+	}
+
+	if !c.LoadDockerImages.PullImages {
+		t.Error("pullImages should default to true")
+	}
+
+	if c.ClusterName("kind") != "kind" {
+		t.Errorf("Expected fallback cluster name 'kind', got '%s'", c.ClusterName("kind"))
+	}
+
+	if c.NodeCount() != 1 || c.UsesWorkers() {
+		t.Errorf("Expected a single node, got %d", c.NodeCount())
+	}
+}
+
+func TestImage(t *testing.T) {
+	all := Image{Name: "nginx:1.25"}
+	workers := Image{Name: "redis:7", Nodes: []string{"worker"}}
+	named := Image{Name: "postgres:15", Nodes: []string{"kind-control-plane", "kind-worker2"}}
+
+	testCases := []struct {
+		image    Image
+		node     string
+		role     string
+		expected bool
+	}{
+		{all, "kind-control-plane", "control-plane", true},
+		{all, "kind-worker", "worker", true},
+		{workers, "kind-control-plane", "control-plane", false},
+		{workers, "kind-worker", "worker", true},
+		{named, "kind-control-plane", "control-plane", true},
+		{named, "kind-worker", "worker", false},
+		{named, "kind-worker2", "worker", true},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.image.OnNode(tc.node, tc.role); got != tc.expected {
+			t.Errorf("Expected %s on %s to be %v, got %v", tc.image.Name, tc.node, tc.expected, got)
+		}
+	}
+
+	// Images without nodes are written back as just the name
+	c := New()
+	c.LoadDockerImages.Images = []Image{all, workers}
+	data, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() returned error: %v", err)
+	}
+	if !strings.Contains(string(data), "- nginx:1.25\n") || !strings.Contains(string(data), "- image: redis:7\n") {
+		t.Errorf("Unexpected images in marshalled config:\n%s", data)
+	}
+
+	if names := ImageNames(c.LoadDockerImages.Images); len(names) != 2 || names[1] != "redis:7" {
+		t.Errorf("Expected image names [nginx:1.25 redis:7], got %v", names)
+	}
+}
+
+func TestImageFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "app.tar")
+	if err := os.WriteFile(archive, []byte("tar"), 0644); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	layout := filepath.Join(dir, "layout")
+	if err := os.MkdirAll(layout, 0755); err != nil {
+		t.Fatalf("Failed to create layout: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(layout, "oci-layout"), []byte(`{"imageLayoutVersion": "1.0.0"}`), 0644); err != nil {
+		t.Fatalf("Failed to write oci-layout: %v", err)
+	}
+
+	testCases := []struct {
+		image         Image
+		isFile        bool
+		path          string
+		expectError   bool
+		expectMissing bool
+	}{
+		{Image{Name: "nginx:1.25"}, false, "nginx:1.25", false, false},
+		{Image{}, false, "", true, false},
+		{Image{Name: ArchivePrefix}, true, "", true, false},
+		{Image{Name: ArchivePrefix + archive}, true, archive, false, false},
+		{Image{Name: ArchivePrefix + filepath.Join(dir, "missing.tar")}, true, filepath.Join(dir, "missing.tar"), false, true},
+		{Image{Name: ArchivePrefix + layout}, true, layout, false, true},
+		{Image{Name: OCILayoutPrefix + layout}, true, layout, false, false},
+		{Image{Name: OCILayoutPrefix + dir}, true, dir, false, true},
+	}
+
+	for _, tc := range testCases {
+		if tc.image.IsFile() != tc.isFile {
+			t.Errorf("Expected IsFile() for '%s' to be %v", tc.image.Name, tc.isFile)
+		}
+		if tc.image.Path() != tc.path {
+			t.Errorf("Expected path '%s' for '%s', got '%s'", tc.path, tc.image.Name, tc.image.Path())
+		}
+		err := tc.image.Validate()
+		if tc.expectError && err == nil {
+			t.Errorf("Expected error for '%s'", tc.image.Name)
+		}
+		if !tc.expectError && err != nil {
+			t.Errorf("Did not expect error for '%s', got: %v", tc.image.Name, err)
+		}
+		if tc.expectError {
+			continue
+		}
+
+		// Whether the files are there is only checked on request
+		err = tc.image.CheckFiles()
+		if tc.expectMissing && err == nil {
+			t.Errorf("Expected missing file error for '%s'", tc.image.Name)
+		}
+		if !tc.expectMissing && err != nil {
+			t.Errorf("Did not expect missing file error for '%s', got: %v", tc.image.Name, err)
+		}
+	}
+}
+
+func TestLocalRegistry(t *testing.T) {
+	r := &LocalRegistry{}
+	if r.ContainerName() != DefaultRegistryName || r.HostPort() != DefaultRegistryPort || r.ContainerImage() != DefaultRegistryImage {
+		t.Errorf("Expected defaults, got %s %d %s", r.ContainerName(), r.HostPort(), r.ContainerImage())
+	}
+	if r.Host() != "localhost:5001" {
+		t.Errorf("Expected host 'localhost:5001', got '%s'", r.Host())
+	}
+
+	r = &LocalRegistry{Name: "my-registry", Port: 5005, Image: "registry:3"}
+	if r.Host() != "localhost:5005" || r.ContainerImage() != "registry:3" {
+		t.Errorf("Unexpected registry %s %s", r.Host(), r.ContainerImage())
+	}
+	if r.HostsTOML() != "[host.\"http://my-registry:5000\"]\n" {
+		t.Errorf("Unexpected hosts.toml: %s", r.HostsTOML())
+	}
+}
+
+func TestRegistryMirror(t *testing.T) {
+	testCases := []struct {
+		mirror    RegistryMirror
+		name      string
+		remoteURL string
+	}{
+		{RegistryMirror{Registry: "docker.io"}, "kind-mirror-docker-io", "https://registry-1.docker.io"},
+		{RegistryMirror{Registry: "registry.k8s.io"}, "kind-mirror-registry-k8s-io", "https://registry.k8s.io"},
+		{RegistryMirror{Registry: "registry.example.com:8443", Remote: "https://mirror.example.com"}, "kind-mirror-registry-example-com-8443", "https://mirror.example.com"},
+		{RegistryMirror{Registry: "ghcr.io", Name: "ghcr-cache"}, "ghcr-cache", "https://ghcr.io"},
+	}
+
+	for _, tc := range testCases {
+		if tc.mirror.ContainerName() != tc.name {
+			t.Errorf("Expected container name '%s', got '%s'", tc.name, tc.mirror.ContainerName())
+		}
+		if tc.mirror.RemoteURL() != tc.remoteURL {
+			t.Errorf("Expected remote URL '%s', got '%s'", tc.remoteURL, tc.mirror.RemoteURL())
+		}
+	}
+
+	toml := RegistryMirror{Registry: "quay.io"}.HostsTOML()
+	if !strings.HasPrefix(toml, "server = \"https://quay.io\"\n") || !strings.Contains(toml, "[host.\"http://kind-mirror-quay-io:5000\"]") {
+		t.Errorf("Unexpected hosts.toml:\n%s", toml)
+	}
+
+	if got := RegistryHostsFile("docker.io"); got != "/etc/containerd/certs.d/docker.io/hosts.toml" {
+		t.Errorf("Unexpected hosts file path: %s", got)
+	}
+}
+
+func TestNodeKindConfig(t *testing.T) {
+	c := New()
+	c.KindConfig = `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+name: registry
+nodes:
+- role: control-plane
+`
+
+	// Without a local registry the kindConfig is used as is
+	kc, err := c.NodeKindConfig()
+	if err != nil {
+		t.Fatalf("NodeKindConfig() returned error: %v", err)
+	}
+	if kc != c.KindConfig {
+		t.Errorf("Expected kindConfig unchanged, got:\n%s", kc)
+	}
+
+	c.LocalRegistry = &LocalRegistry{}
+	kc, err = c.NodeKindConfig()
+	if err != nil {
+		t.Fatalf("NodeKindConfig() returned error: %v", err)
+	}
+	patched := &BeKindConfig{KindConfig: kc}
+	cluster, err := patched.Cluster()
+	if err != nil {
+		t.Fatalf("Patched kindConfig doesn't parse: %v", err)
+	}
+	if cluster.Name != "registry" || len(cluster.Nodes) != 1 {
+		t.Errorf("Expected the rest of the kindConfig to be kept, got %+v", cluster)
+	}
+	if len(cluster.ContainerdConfigPatches) != 1 || !strings.Contains(cluster.ContainerdConfigPatches[0], RegistryConfigPath) {
+		t.Errorf("Expected containerd patch for the registry, got %v", cluster.ContainerdConfigPatches)
+	}
+
+	// Existing patches are kept
+	c.KindConfig += "containerdConfigPatches:\n- |-\n  [debug]\n    level = \"debug\"\n"
+	kc, err = c.NodeKindConfig()
+	if err != nil {
+		t.Fatalf("NodeKindConfig() returned error: %v", err)
+	}
+	cluster, err = (&BeKindConfig{KindConfig: kc}).Cluster()
+	if err != nil {
+		t.Fatalf("Patched kindConfig doesn't parse: %v", err)
+	}
+	if len(cluster.ContainerdConfigPatches) != 2 || !strings.Contains(cluster.ContainerdConfigPatches[0], "debug") {
+		t.Errorf("Expected existing patch to be kept, got %v", cluster.ContainerdConfigPatches)
+	}
+}
+
+func TestHelmChartOptions(t *testing.T) {
+	h := HelmChart{}
+	if d, err := h.TimeoutDuration(); err != nil || d != DefaultHelmTimeout {
+		t.Errorf("Expected default timeout %v, got %v (%v)", DefaultHelmTimeout, d, err)
+	}
+	if !h.ShouldCreateNamespace() || h.ShouldWait() {
+		t.Error("Expected namespace to be created and no wait by default")
+	}
+
+	c, err := Parse([]byte(`helmCharts:
+  - url: "https://prometheus-community.github.io/helm-charts"
+    repo: "prometheus-community"
+    chart: "kube-prometheus-stack"
+    release: "monitoring"
+    namespace: "monitoring"
+    timeout: "10m"
+    atomic: true
+    waitForJobs: true
+    skipCRDs: true
+    disableHooks: true
+    createNamespace: false
+`))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+
+	h = c.HelmCharts[0]
+	if d, err := h.TimeoutDuration(); err != nil || d != 10*time.Minute {
+		t.Errorf("Expected timeout 10m, got %v (%v)", d, err)
+	}
+	if !h.Atomic || !h.WaitForJobs || !h.SkipCRDs || !h.DisableHooks {
+		t.Errorf("Expected all options to be set, got %+v", h)
+	}
+	if h.ShouldCreateNamespace() {
+		t.Error("Expected createNamespace: false to be honored")
+	}
+	if !h.ShouldWait() {
+		t.Error("Expected atomic to imply wait")
+	}
+
+	if h.Source() != "prometheus-community/kube-prometheus-stack from https://prometheus-community.github.io/helm-charts" {
+		t.Errorf("Unexpected source: %s", h.Source())
+	}
+	if h := (HelmChart{Path: "/charts/myapp"}); !h.IsLocal() || h.Source() != "/charts/myapp" {
+		t.Errorf("Expected a local chart, got source %s", h.Source())
+	}
+	if h := (HelmChart{Url: "oci://registry.example.com/charts/app"}); h.IsLocal() || h.Source() != "oci://registry.example.com/charts/app" {
+		t.Errorf("Expected an OCI chart, got source %s", h.Source())
+	}
+
+	t.Setenv("HOME", "/home/dev")
+	if k := h.KeyringPath(); k != "/home/dev/.gnupg/pubring.gpg" {
+		t.Errorf("Expected Helm's default keyring, got %s", k)
+	}
+	h.Keyring = "/keys/pubring.gpg"
+	if k := h.KeyringPath(); k != "/keys/pubring.gpg" {
+		t.Errorf("Expected the chart's keyring, got %s", k)
+	}
+
+	h.Timeout = "ten minutes"
+	if _, err := h.TimeoutDuration(); err == nil {
+		t.Error("Expected an error for an invalid timeout")
+	}
+}
+
+func TestHelmAuth(t *testing.T) {
+	var nilAuth *HelmAuth
+	if u, p, err := nilAuth.Credentials(); u != "" || p != "" || err != nil {
+		t.Errorf("Expected no credentials without auth, got %s/%s (%v)", u, p, err)
+	}
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+	t.Setenv("TEST_HELM_USERNAME", "dev")
+
+	a := &HelmAuth{UsernameEnv: "TEST_HELM_USERNAME", PasswordFile: passwordFile}
+	if err := a.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if u, p, err := a.Credentials(); u != "dev" || p != "s3cret" || err != nil {
+		t.Errorf("Expected dev/s3cret, got %s/%s (%v)", u, p, err)
+	}
+
+	a.UsernameEnv = "TEST_HELM_MISSING"
+	if _, _, err := a.Credentials(); err == nil || err.Error() != "username: environment variable TEST_HELM_MISSING is not set" {
+		t.Errorf("Expected an error for a missing environment variable, got %v", err)
+	}
+
+	for _, bad := range []HelmAuth{
+		{UsernameEnv: "USER", UsernameFile: "user"},
+		{UsernameEnv: "USER", PasswordEnv: "PASS", PasswordFile: "pass"},
+		{PasswordEnv: "PASS"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Expected an error for %+v", bad)
+		}
+	}
+}
+
+func TestPostRendererValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		renderer    PostRenderer
+		expectError bool
+	}{
+		{"exec", PostRenderer{Exec: "kustomize-renderer"}, false},
+		{"inline patch", PostRenderer{Patches: []PostRenderPatch{{Patch: "kind: Job"}}}, false},
+		{"patch file", PostRenderer{Patches: []PostRenderPatch{{Path: "patch.yaml"}}}, false},
+		{"empty", PostRenderer{}, true},
+		{"patch without source", PostRenderer{Patches: []PostRenderPatch{{Target: &PatchTarget{Kind: "Job"}}}}, true},
+		{"patch with both sources", PostRenderer{Patches: []PostRenderPatch{{Patch: "kind: Job", Path: "patch.yaml"}}}, true},
+	}
+
+	for _, tc := range testCases {
+		if err := tc.renderer.Validate(); (err != nil) != tc.expectError {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.expectError, err)
+		}
+	}
+}
+
+func TestOutputValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		output      Output
+		expectError bool
+	}{
+		{"secret key", Output{Name: "password", Secret: "admin", Key: "password"}, false},
+		{"configmap jsonPath", Output{Name: "host", ConfigMap: "settings", JSONPath: "{.data.host}"}, false},
+		{"ingress", Output{Name: "url", Ingress: "web", Format: "https://%s"}, false},
+		{"httpRoute", Output{Name: "url", HTTPRoute: "web"}, false},
+		{"service port", Output{Name: "nodePort", Service: "web", Port: "http"}, false},
+		{"no name", Output{Ingress: "web"}, true},
+		{"no object", Output{Name: "url"}, true},
+		{"two objects", Output{Name: "url", Ingress: "web", HTTPRoute: "web"}, true},
+		{"secret without key", Output{Name: "password", Secret: "admin"}, true},
+		{"key on ingress", Output{Name: "url", Ingress: "web", Key: "host"}, true},
+		{"port on secret", Output{Name: "password", Secret: "admin", Key: "password", Port: "80"}, true},
+		{"bad jsonPath", Output{Name: "url", Ingress: "web", JSONPath: "{.spec"}, true},
+		{"format without value", Output{Name: "url", Ingress: "web", Format: "https://"}, true},
+	}
+
+	for _, tc := range testCases {
+		if err := tc.output.Validate(); (err != nil) != tc.expectError {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.expectError, err)
+		}
+	}
+
+	if v := (Output{Format: "https://%s/ui"}).FormatValue("argocd.local"); v != "https://argocd.local/ui" {
+		t.Errorf("Unexpected formatted value %q", v)
+	}
+	if v := (Output{}).FormatValue("30080"); v != "30080" {
+		t.Errorf("Unexpected formatted value %q", v)
+	}
+}
+
+func TestChartOutputs(t *testing.T) {
+	// Outputs default to the chart's namespace
+	h := HelmChart{Chart: "grafana", Namespace: "monitoring", Outputs: []Output{
+		{Name: "url", Ingress: "grafana"},
+		{Name: "password", Secret: "grafana", Key: "admin-password", Namespace: "secrets"},
+	}}
+	outputs := h.ChartOutputs()
+	if len(outputs) != 2 || outputs[0].Namespace != "monitoring" || outputs[1].Namespace != "secrets" {
+		t.Errorf("Unexpected outputs: %+v", outputs)
+	}
+	if h.Outputs[0].Namespace != "" {
+		t.Error("ChartOutputs shouldn't change the chart's outputs")
+	}
+
+	// No chart gets outputs it doesn't set, Argo CD included
+	if outputs = (HelmChart{Chart: "argo-cd", Namespace: "argocd"}).ChartOutputs(); len(outputs) != 0 {
+		t.Errorf("Expected no outputs, got %+v", outputs)
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"values.yaml", "/profiles/dev/values.yaml"},
+		{"values/app.yaml", "/profiles/dev/values/app.yaml"},
+		{"../shared/values.yaml", "/profiles/shared/values.yaml"},
+		{"/etc/values.yaml", "/etc/values.yaml"},
+		{"file:///etc/values.yaml", "/etc/values.yaml"},
+		{"https://example.com/values.yaml", "https://example.com/values.yaml"},
+	}
+
+	for _, tc := range testCases {
+		if got := ResolvePath("/profiles/dev", tc.path); got != tc.expected {
+			t.Errorf("Expected ResolvePath(%s) to be '%s', got '%s'", tc.path, tc.expected, got)
+		}
+	}
+}
+
+func TestHelmChartDependencies(t *testing.T) {
+	chart := func(release string, dependsOn ...string) HelmChart {
+		return HelmChart{Release: release, DependsOn: dependsOn}
+	}
+
+	testCases := []struct {
+		name     string
+		charts   []HelmChart
+		expected [][]int
+		err      string
+	}{
+		{
+			name:     "no dependencies",
+			charts:   []HelmChart{chart("a"), chart("b")},
+			expected: [][]int{nil, nil},
+		},
+		{
+			name:     "dependencies",
+			charts:   []HelmChart{chart("argocd", "cert-manager", "ingress"), chart("cert-manager"), chart("ingress", "cert-manager")},
+			expected: [][]int{{1, 2}, nil, {1}},
+		},
+		{
+			name:   "unknown release",
+			charts: []HelmChart{chart("a", "nope")},
+			err:    `helmCharts[0]: dependsOn: unknown release "nope"`,
+		},
+		{
+			name:   "depends on itself",
+			charts: []HelmChart{chart("a", "a")},
+			err:    "helmCharts[0]: dependsOn: dependency cycle a -> a",
+		},
+		{
+			name:   "cycle",
+			charts: []HelmChart{chart("a"), chart("b", "c"), chart("c", "d"), chart("d", "b")},
+			err:    "helmCharts[1]: dependsOn: dependency cycle b -> c -> d -> b",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deps, err := HelmChartDependencies(tc.charts)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Errorf("Expected error '%s', got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if fmt.Sprint(deps) != fmt.Sprint(tc.expected) {
+				t.Errorf("Expected dependencies %v, got %v", tc.expected, deps)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	kindConfig := "kind: Cluster\napiVersion: kind.x-k8s.io/v1alpha4\n"
+
+	testCases := []struct {
+		name        string
+		modify      func(c *BeKindConfig)
+		expectError bool
+	}{
+		{
+			name:        "valid",
+			modify:      func(c *BeKindConfig) {},
+			expectError: false,
+		},
+		{
+			name:        "missing kindConfig",
+			modify:      func(c *BeKindConfig) { c.KindConfig = "" },
+			expectError: true,
+		},
+		{
+			name:        "unsupported apiVersion",
+			modify:      func(c *BeKindConfig) { c.APIVersion = "bekind.chernand.io/v9" },
+			expectError: true,
+		},
+		{
+			name: "image missing name",
+			modify: func(c *BeKindConfig) {
+				c.LoadDockerImages.Images = []Image{{Nodes: []string{"worker"}}}
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid registry port",
+			modify: func(c *BeKindConfig) {
+				c.LocalRegistry = &LocalRegistry{Port: 70000}
+			},
+			expectError: true,
+		},
+		{
+			name: "registry mirror missing registry",
+			modify: func(c *BeKindConfig) {
+				c.RegistryMirrors = []RegistryMirror{{Remote: "https://registry-1.docker.io"}}
+			},
+			expectError: true,
+		},
+		{
+			name: "chart with invalid timeout",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Url: "https://charts.example.com", Repo: "example", Chart: "app", Release: "app", Namespace: "app", Timeout: "3"}}
+			},
+			expectError: true,
+		},
+		{
+			name: "chart with bad set",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Url: "https://charts.example.com", Repo: "example", Chart: "app", Release: "app", Namespace: "app", Set: []string{"replicas"}}}
+			},
+			expectError: true,
+		},
+		{
+			name: "chart with dependency cycle",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{
+					{Url: "oci://registry.example.com/charts/a", Release: "a", Namespace: "a", DependsOn: []string{"b"}},
+					{Url: "oci://registry.example.com/charts/b", Release: "b", Namespace: "b", DependsOn: []string{"a"}},
+				}
+			},
+			expectError: true,
+		},
+		{
+			name: "chart missing release",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Url: "https://charts.example.com", Repo: "example", Chart: "app", Namespace: "app"}}
+			},
+			expectError: true,
+		},
+		{
+			name: "chart missing chart",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Url: "https://charts.example.com", Repo: "example", Release: "app", Namespace: "app"}}
+			},
+			expectError: true,
+		},
+		{
+			name: "chart missing repo",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Url: "https://charts.example.com", Chart: "app", Release: "app", Namespace: "app"}}
+			},
+			expectError: true,
+		},
+		{
+			name: "local chart",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Path: "./charts/myapp", Release: "app", Namespace: "app"}}
+			},
+			expectError: false,
+		},
+		{
+			name: "local chart with url",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Path: "./charts/myapp", Url: "https://charts.example.com", Release: "app", Namespace: "app"}}
+			},
+			expectError: true,
+		},
+		{
+			name: "OCI chart with digest",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Url: "oci://registry.example.com/charts/app", Release: "app", Namespace: "app", Digest: "sha256:" + strings.Repeat("0f", 32)}}
+			},
+			expectError: false,
+		},
+		{
+			name: "OCI chart with bad digest",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Url: "oci://registry.example.com/charts/app", Release: "app", Namespace: "app", Digest: "sha256:1234"}}
+			},
+			expectError: true,
+		},
+		{
+			name: "repo chart with digest",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Url: "https://charts.example.com", Repo: "example", Chart: "app", Release: "app", Namespace: "app", Digest: "sha256:" + strings.Repeat("0f", 32)}}
+			},
+			expectError: true,
+		},
+		{
+			name: "bad chart output",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Url: "oci://registry.example.com/charts/app", Release: "app", Namespace: "app", Outputs: []Output{{Name: "url"}}}}
+			},
+			expectError: true,
+		},
+		{
+			name: "bad top level output",
+			modify: func(c *BeKindConfig) {
+				c.Outputs = []Output{{Name: "password", Secret: "admin"}}
+			},
+			expectError: true,
+		},
+		{
+			name: "keyring without verify",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Url: "oci://registry.example.com/charts/app", Release: "app", Namespace: "app", Keyring: "/keys/pubring.gpg"}}
+			},
+			expectError: true,
+		},
+		{
+			name: "OCI chart without chart",
+			modify: func(c *BeKindConfig) {
+				c.HelmCharts = []HelmChart{{Url: "oci://registry.example.com/charts/app", Release: "app", Namespace: "app"}}
+			},
+			expectError: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := New()
+			c.KindConfig = kindConfig
+			tc.modify(c)
+
+			err := c.Validate()
+			if tc.expectError && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("Did not expect error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadAndMarshal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := []byte(`
+kindConfig: |
+  kind: Cluster
+  apiVersion: kind.x-k8s.io/v1alpha4
+helmCharts:
+  - url: "oci://registry.example.com/charts/app"
+    release: "app"
+    namespace: "app"
+    valuesObject:
+      fullnameOverride: myApp
+    valuesFiles:
+      - values/app.yaml
+      - /etc/bekind/app.yaml
+      - https://example.com/values.yaml
+  - path: charts/myapp
+    release: "myapp"
+    namespace: "dev"
+    auth:
+      usernameEnv: REGISTRY_USERNAME
+      passwordFile: secrets/password
+    postRenderer:
+      patches:
+        - path: patches/job.yaml
+      exec: ./bin/renderer
+`)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	// Relative values files are relative to the config file
+	expected := []string{filepath.Join(filepath.Dir(path), "values", "app.yaml"), "/etc/bekind/app.yaml", "https://example.com/values.yaml"}
+	if strings.Join(c.HelmCharts[0].ValuesFiles, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected values files %v, got %v", expected, c.HelmCharts[0].ValuesFiles)
+	}
+	if want := filepath.Join(filepath.Dir(path), "charts", "myapp"); c.HelmCharts[1].Path != want {
+		t.Errorf("Expected chart path %s, got %s", want, c.HelmCharts[1].Path)
+	}
+	if want := filepath.Join(filepath.Dir(path), "secrets", "password"); c.HelmCharts[1].Auth.PasswordFile != want {
+		t.Errorf("Expected password file %s, got %s", want, c.HelmCharts[1].Auth.PasswordFile)
+	}
+	if pr := c.HelmCharts[1].PostRenderer; pr.Patches[0].Path != filepath.Join(filepath.Dir(path), "patches", "job.yaml") || pr.Exec != filepath.Join(filepath.Dir(path), "bin", "renderer") {
+		t.Errorf("Expected post renderer paths relative to the config file, got %+v", pr)
+	}
+
+	// Marshalling and parsing again should give back the same config
+	out, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() returned error: %v", err)
+	}
+
+	c2, err := Parse(out)
+	if err != nil {
+		t.Fatalf("Parse() of marshalled config returned error: %v", err)
+	}
+
+	if c2.APIVersion != APIVersion || c2.KindConfig != c.KindConfig || len(c2.HelmCharts) != 2 {
+		t.Errorf("Round trip did not preserve the config:\n%s", string(out))
+	}
+
+	if c2.HelmCharts[0].ValuesObject["fullnameOverride"] != "myApp" {
+		t.Errorf("Expected valuesObject to survive the round trip, got %v", c2.HelmCharts[0].ValuesObject)
+	}
+
+	// Missing files are an error
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load() should fail for a missing file")
+	}
+}
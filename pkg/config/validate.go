@@ -0,0 +1,488 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+// yamlLineError matches the line number yaml puts in front of its error messages
+var yamlLineError = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// Problem is an issue found in a config file
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// String returns the problem as "file:line: message"
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// LintFile reads the given config file and returns every problem found in it
+func LintFile(path string) []Problem {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []Problem{{File: path, Message: err.Error()}}
+	}
+
+	return Lint(path, data)
+}
+
+// Lint returns every problem found in the config. Each problem points to the line in the file
+// it was found on.
+func Lint(file string, data []byte) []Problem {
+	l := &linter{file: file, files: true}
+
+	// Decode into a node tree first so we know where everything is in the file
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		l.addYAMLError(0, "", err)
+		return l.problems
+	}
+	if len(doc.Content) == 0 {
+		l.add(0, "config is empty")
+		return l.problems
+	}
+	root := doc.Content[0]
+	if root.Kind != yamlv3.MappingNode {
+		l.add(root.Line, "config must be a YAML mapping")
+		return l.problems
+	}
+
+	// Check for keys that aren't part of the schema
+	l.unknownKeys(root, reflect.TypeOf(BeKindConfig{}), "")
+
+	c, err := Parse(data)
+	if err != nil {
+		l.addYAMLError(0, "", err)
+		return l.problems
+	}
+
+	l.config(c, root)
+
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		return l.problems[i].Line < l.problems[j].Line
+	})
+
+	return l.problems
+}
+
+// Validate checks that the config can be used to create a cluster. It has the same rules as
+// Lint, apart from checking the keys in the file and that the local files it uses are there.
+func (c *BeKindConfig) Validate() error {
+	l := &linter{}
+	l.config(c, nil)
+
+	var errs []error
+	for _, p := range l.problems {
+		errs = append(errs, errors.New(p.Message))
+	}
+
+	return errors.Join(errs...)
+}
+
+// linter collects the problems found in a single file
+type linter struct {
+	file string
+	// files makes the linter check that the local files the config uses are there
+	files    bool
+	problems []Problem
+}
+
+// config checks the parsed config. root is the config in the file, it's nil when the config
+// isn't from a file and the problems don't have lines.
+func (l *linter) config(c *BeKindConfig, root *yamlv3.Node) {
+	if c.APIVersion != APIVersion {
+		l.add(keyLine(root, "apiVersion"), fmt.Sprintf("unsupported apiVersion %q, expected %q", c.APIVersion, APIVersion))
+	}
+	if c.Kind != Kind {
+		l.add(keyLine(root, "kind"), fmt.Sprintf("unsupported kind %q, expected %q", c.Kind, Kind))
+	}
+
+	l.kindConfig(c, valueNode(root, "kindConfig"))
+	l.images(c, valueNode(valueNode(root, "loadDockerImages"), "images"))
+	l.helmCharts(c, valueNode(root, "helmCharts"))
+
+	if r := c.LocalRegistry; r != nil && (r.Port < 0 || r.Port > 65535) {
+		l.add(keyLine(valueNode(root, "localRegistry"), "port"), fmt.Sprintf("localRegistry: invalid port %d", r.Port))
+	}
+	for i, m := range c.RegistryMirrors {
+		if m.Registry == "" {
+			l.add(itemLine(root, "registryMirrors", i), fmt.Sprintf("registryMirrors[%d]: registry is required", i))
+		}
+	}
+
+	for i, m := range c.PostInstallManifests {
+		if err := ValidateManifestURL(m); err != nil {
+			l.add(itemLine(root, "postInstallManifests", i), fmt.Sprintf("postInstallManifests[%d]: %v", i, err))
+		}
+	}
+
+	for i, a := range c.PostInstallActions {
+		if err := a.Validate(); err != nil {
+			l.add(itemLine(root, "postInstallActions", i), fmt.Sprintf("postInstallActions[%d]: %v", i, err))
+		}
+	}
+
+	for i, o := range c.Outputs {
+		if err := o.Validate(); err != nil {
+			l.add(itemLine(root, "outputs", i), fmt.Sprintf("outputs[%d]: %v", i, err))
+		}
+	}
+}
+
+// add records a problem found on the given line
+func (l *linter) add(line int, msg string) {
+	l.problems = append(l.problems, Problem{File: l.file, Line: line, Message: msg})
+}
+
+// addYAMLError records a yaml decoding error, using the line number in the error message
+// (shifted by offset) when there is one
+func (l *linter) addYAMLError(offset int, prefix string, err error) {
+	msgs := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	}
+
+	for _, msg := range msgs {
+		m := yamlLineError.FindStringSubmatch(msg)
+		if m == nil {
+			l.add(offset, prefix+msg)
+			continue
+		}
+		line, _ := strconv.Atoi(m[1])
+		l.add(offset+line, prefix+m[2])
+	}
+}
+
+// unknownKeys walks the node tree alongside the schema type and reports keys the schema doesn't have
+func (l *linter) unknownKeys(n *yamlv3.Node, t reflect.Type, path string) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		l.unknownKeys(n, t.Elem(), path)
+	case reflect.Slice:
+		if n.Kind != yamlv3.SequenceNode {
+			return
+		}
+		for i, item := range n.Content {
+			l.unknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Struct:
+		if n.Kind != yamlv3.MappingNode {
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			key := k.Value
+			if path != "" {
+				key = path + "." + k.Value
+			}
+			ft, ok := fields[k.Value]
+			if !ok {
+				l.add(k.Line, fmt.Sprintf("unknown key %q", key))
+				continue
+			}
+			l.unknownKeys(v, ft, key)
+		}
+	}
+}
+
+// kindConfig checks the kindConfig against the KIND v1alpha4 API types
+func (l *linter) kindConfig(c *BeKindConfig, n *yamlv3.Node) {
+	if c.KindConfig == "" {
+		l.add(0, "kindConfig is required")
+		return
+	}
+
+	// Block scalars start on the line after the key, plain ones on the same line
+	offset := 0
+	if n != nil {
+		offset = n.Line - 1
+		if n.Style&(yamlv3.LiteralStyle|yamlv3.FoldedStyle) != 0 {
+			offset = n.Line
+		}
+	}
+
+	// Report unknown fields, but keep going with what could be decoded
+	cluster := &v1alpha4.Cluster{}
+	if err := yaml.UnmarshalStrict([]byte(c.KindConfig), cluster); err != nil {
+		l.addYAMLError(offset, "kindConfig: ", err)
+		cluster = &v1alpha4.Cluster{}
+		if err := yaml.Unmarshal([]byte(c.KindConfig), cluster); err != nil {
+			return
+		}
+	}
+
+	// Find where things are in the kindConfig so problems can point at them
+	var doc yamlv3.Node
+	root := &yamlv3.Node{}
+	if err := yamlv3.Unmarshal([]byte(c.KindConfig), &doc); err == nil && len(doc.Content) != 0 {
+		root = doc.Content[0]
+	}
+	lineOf := func(line int) int {
+		switch {
+		case n == nil:
+			return 0
+		case line == 0:
+			return n.Line
+		}
+		return offset + line
+	}
+
+	if cluster.Kind != "Cluster" {
+		l.add(lineOf(keyLine(root, "kind")), fmt.Sprintf("kindConfig: unsupported kind %q, expected \"Cluster\"", cluster.Kind))
+	}
+	if cluster.APIVersion != "kind.x-k8s.io/v1alpha4" {
+		l.add(lineOf(keyLine(root, "apiVersion")), fmt.Sprintf("kindConfig: unsupported apiVersion %q, expected \"kind.x-k8s.io/v1alpha4\"", cluster.APIVersion))
+	}
+	for i, node := range cluster.Nodes {
+		if node.Role != v1alpha4.ControlPlaneRole && node.Role != v1alpha4.WorkerRole {
+			l.add(lineOf(itemLine(root, "nodes", i)), fmt.Sprintf("kindConfig: nodes[%d]: unsupported role %q", i, node.Role))
+		}
+	}
+}
+
+// images checks that each image has a name, and that images loaded from disk are there
+func (l *linter) images(c *BeKindConfig, n *yamlv3.Node) {
+	for i, img := range c.LoadDockerImages.Images {
+		line := 0
+		if n != nil && i < len(n.Content) {
+			line = n.Content[i].Line
+		}
+
+		if err := img.Validate(); err != nil {
+			l.add(line, fmt.Sprintf("loadDockerImages.images[%d]: %v", i, err))
+		} else if l.files {
+			if err := img.CheckFiles(); err != nil {
+				l.add(line, fmt.Sprintf("loadDockerImages.images[%d]: %v", i, err))
+			}
+		}
+	}
+}
+
+// helmCharts checks that each chart has what it needs to be installed
+func (l *linter) helmCharts(c *BeKindConfig, n *yamlv3.Node) {
+	releases := make(map[string]bool)
+	for _, h := range c.HelmCharts {
+		releases[h.Release] = true
+	}
+
+	for i, h := range c.HelmCharts {
+		line := 0
+		if n != nil && i < len(n.Content) {
+			line = n.Content[i].Line
+		}
+
+		var missing []string
+		if h.Url == "" && !h.IsLocal() {
+			missing = append(missing, "url or path")
+		}
+		if h.Chart == "" && !h.IsOCI() && !h.IsLocal() && h.Url != "" {
+			missing = append(missing, "chart")
+		}
+		if h.Repo == "" && !h.IsOCI() && !h.IsLocal() && h.Url != "" {
+			missing = append(missing, "repo")
+		}
+		if h.Release == "" {
+			missing = append(missing, "release")
+		}
+		if h.Namespace == "" {
+			missing = append(missing, "namespace")
+		}
+		if len(missing) != 0 {
+			l.add(line, fmt.Sprintf("helmCharts[%d]: missing %s", i, strings.Join(missing, ", ")))
+		}
+		var item *yamlv3.Node
+		if n != nil && i < len(n.Content) {
+			item = n.Content[i]
+		}
+		if _, err := h.TimeoutDuration(); err != nil {
+			l.add(keyLine(item, "timeout"), fmt.Sprintf("helmCharts[%d]: %v", i, err))
+		}
+
+		if h.IsLocal() {
+			if h.Url != "" {
+				l.add(keyLine(item, "path"), fmt.Sprintf("helmCharts[%d]: only one of path and url can be set", i))
+			}
+			if l.files {
+				if fi, err := os.Stat(ResolvePath(filepath.Dir(l.file), h.Path)); err != nil {
+					l.add(keyLine(item, "path"), fmt.Sprintf("helmCharts[%d]: %v", i, err))
+				} else if fi.IsDir() && h.Verify {
+					l.add(keyLine(item, "verify"), fmt.Sprintf("helmCharts[%d]: only packaged charts can be verified", i))
+				}
+			}
+		}
+
+		if a := h.Auth; a != nil {
+			authNode := valueNode(item, "auth")
+			if err := a.Validate(); err != nil {
+				l.add(lineOr(keyLine(item, "auth"), line), fmt.Sprintf("helmCharts[%d]: auth: %v", i, err))
+			}
+			for _, f := range []struct{ key, path string }{
+				{"usernameFile", a.UsernameFile},
+				{"passwordFile", a.PasswordFile},
+				{"caFile", a.CAFile},
+			} {
+				if f.path == "" || !l.files {
+					continue
+				}
+				if _, err := os.Stat(ResolvePath(filepath.Dir(l.file), f.path)); err != nil {
+					l.add(lineOr(keyLine(authNode, f.key), line), fmt.Sprintf("helmCharts[%d]: auth: %s: %v", i, f.key, err))
+				}
+			}
+		}
+
+		if r := h.PostRenderer; r != nil {
+			prNode := valueNode(item, "postRenderer")
+			if err := r.Validate(); err != nil {
+				l.add(lineOr(keyLine(item, "postRenderer"), line), fmt.Sprintf("helmCharts[%d]: postRenderer: %v", i, err))
+			}
+			for j, p := range r.Patches {
+				if p.Path == "" || !l.files {
+					continue
+				}
+				if _, err := os.Stat(ResolvePath(filepath.Dir(l.file), p.Path)); err != nil {
+					l.add(lineOr(itemLine(prNode, "patches", j), line), fmt.Sprintf("helmCharts[%d]: postRenderer: patches[%d]: %v", i, j, err))
+				}
+			}
+		}
+
+		if h.Keyring != "" && !h.Verify {
+			l.add(keyLine(item, "keyring"), fmt.Sprintf("helmCharts[%d]: keyring is only used with verify", i))
+		}
+		if h.Verify && l.files {
+			if _, err := os.Stat(ResolvePath(filepath.Dir(l.file), h.KeyringPath())); err != nil {
+				l.add(lineOr(keyLine(item, "keyring"), keyLine(item, "verify")), fmt.Sprintf("helmCharts[%d]: keyring: %v", i, err))
+			}
+		}
+		if h.Digest != "" {
+			if !h.IsOCI() {
+				l.add(keyLine(item, "digest"), fmt.Sprintf("helmCharts[%d]: digest is only supported for OCI charts", i))
+			} else if err := validDigest(h.Digest); err != nil {
+				l.add(keyLine(item, "digest"), fmt.Sprintf("helmCharts[%d]: %v", i, err))
+			}
+		}
+
+		// Local values files must be there
+		for j, f := range h.ValuesFiles {
+			p := ResolvePath(filepath.Dir(l.file), f)
+			if strings.Contains(p, "://") || !l.files {
+				continue
+			}
+			if _, err := os.Stat(p); err != nil {
+				l.add(lineOr(itemLine(item, "valuesFiles", j), line), fmt.Sprintf("helmCharts[%d]: valuesFiles[%d]: %v", i, j, err))
+			}
+		}
+
+		for _, key := range []string{"set", "setString"} {
+			list := h.Set
+			if key == "setString" {
+				list = h.SetString
+			}
+			for j, kv := range list {
+				if !strings.Contains(kv, "=") {
+					l.add(lineOr(itemLine(item, key, j), line), fmt.Sprintf("helmCharts[%d]: %s[%d]: %q is not in key=value form", i, key, j, kv))
+				}
+			}
+		}
+
+		for j, o := range h.Outputs {
+			if err := o.Validate(); err != nil {
+				l.add(lineOr(itemLine(item, "outputs", j), line), fmt.Sprintf("helmCharts[%d]: outputs[%d]: %v", i, j, err))
+			}
+		}
+
+		for j, r := range h.DependsOn {
+			if !releases[r] {
+				l.add(lineOr(itemLine(item, "dependsOn", j), line), fmt.Sprintf("helmCharts[%d]: dependsOn[%d]: unknown release %q", i, j, r))
+			}
+		}
+	}
+
+	// Charts that depend on each other can never be installed
+	if cycle := dependencyCycle(dependencyIndexes(c.HelmCharts)); cycle != nil {
+		line := 0
+		if n != nil && cycle[0] < len(n.Content) {
+			line = keyLine(n.Content[cycle[0]], "dependsOn")
+		}
+		l.add(line, fmt.Sprintf("helmCharts[%d]: dependsOn: dependency cycle %s", cycle[0], cyclePath(c.HelmCharts, cycle)))
+	}
+}
+
+// lineOr returns line, or fallback if line is 0
+func lineOr(line int, fallback int) int {
+	if line == 0 {
+		return fallback
+	}
+
+	return line
+}
+
+// yamlFields returns the yaml keys of a struct mapped to their types
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+
+	return fields
+}
+
+// valueNode returns the value of key in a mapping node, or nil if it isn't there
+func valueNode(n *yamlv3.Node, key string) *yamlv3.Node {
+	if n == nil || n.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// keyLine returns the line key is on in a mapping node, or 0 if it isn't there
+func keyLine(n *yamlv3.Node, key string) int {
+	if v := valueNode(n, key); v != nil {
+		return v.Line
+	}
+
+	return 0
+}
+
+// itemLine returns the line of the i-th item of the sequence under key, or 0 if it isn't there
+func itemLine(n *yamlv3.Node, key string, i int) int {
+	if v := valueNode(n, key); v != nil && i < len(v.Content) {
+		return v.Content[i].Line
+	}
+
+	return 0
+}
@@ -0,0 +1,459 @@
+/*
+Copyright © 2026 Christian Hernandez christian@chernand.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	data := []byte(`domian: "7f000001.nip.io"
+kindConfig: |
+  kind: Cluster
+  apiVersion: kind.x-k8s.io/v1alpha4
+  nodez: []
+  nodes:
+  - role: master
+helmCharts:
+  - url: "https://charts.example.com"
+    release: "app"
+    valuesObjects: {}
+postInstallManifests:
+  - "ftp://example.com/app.yaml"
+postInstallActions:
+  - action: restart
+    kind: Pod
+    name: test
+`)
+
+	expected := []struct {
+		line    int
+		message string
+	}{
+		{1, `unknown key "domian"`},
+		{5, "kindConfig: field nodez not found"},
+		{7, `kindConfig: nodes[0]: unsupported role "master"`},
+		{9, "helmCharts[0]: missing chart, repo, namespace"},
+		{11, `unknown key "helmCharts[0].valuesObjects"`},
+		{13, "postInstallManifests[0]: unsupported manifest"},
+		{15, "postInstallActions[0]: unsupported kind 'Pod' for restart action"},
+	}
+
+	problems := Lint("config.yaml", data)
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expected), len(problems), problems)
+	}
+
+	for i, e := range expected {
+		p := problems[i]
+		if p.Line != e.line {
+			t.Errorf("Expected problem %d on line %d, got line %d (%s)", i, e.line, p.Line, p.Message)
+		}
+		if !strings.HasPrefix(p.Message, e.message) {
+			t.Errorf("Expected problem %d to start with '%s', got '%s'", i, e.message, p.Message)
+		}
+		if p.File != "config.yaml" {
+			t.Errorf("Expected file 'config.yaml', got '%s'", p.File)
+		}
+	}
+}
+
+func TestValidateUsesLintRules(t *testing.T) {
+	data := []byte(`kindConfig: |
+  kind: Cluster
+  apiVersion: kind.x-k8s.io/v1alpha4
+  nodes:
+  - role: master
+helmCharts:
+  - url: "https://charts.example.com"
+    repo: "example"
+    release: "app"
+    valuesFiles:
+      - missing-values.yaml
+postInstallManifests:
+  - "ftp://example.com/app.yaml"
+`)
+
+	c, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	err = c.Validate()
+	if err == nil {
+		t.Fatal("Expected Validate() to return an error")
+	}
+
+	// Validate finds what Lint does, apart from the missing values file
+	var expected []string
+	for _, p := range Lint(filepath.Join(t.TempDir(), "config.yaml"), data) {
+		if !strings.Contains(p.Message, "valuesFiles") {
+			expected = append(expected, p.Message)
+		}
+	}
+	if len(expected) != 3 {
+		t.Fatalf("Expected 3 problems from Lint, got %v", expected)
+	}
+	if err.Error() != strings.Join(expected, "\n") {
+		t.Errorf("Expected Validate() to return:\n%s\ngot:\n%v", strings.Join(expected, "\n"), err)
+	}
+}
+
+func TestLintImages(t *testing.T) {
+	data := []byte(`kindConfig: |
+  kind: Cluster
+  apiVersion: kind.x-k8s.io/v1alpha4
+loadDockerImages:
+  images:
+    - nginx:1.25
+    - nodes:
+        - worker
+    - image: redis:7
+      node: worker
+`)
+
+	problems := Lint("config.yaml", data)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %d: %v", len(problems), problems)
+	}
+	if problems[0].Line != 7 || problems[0].Message != "loadDockerImages.images[1]: image is required" {
+		t.Errorf("Unexpected first problem: %s", problems[0])
+	}
+	if problems[1].Line != 10 || problems[1].Message != `unknown key "loadDockerImages.images[2].node"` {
+		t.Errorf("Unexpected second problem: %s", problems[1])
+	}
+
+	// Only Lint checks that images loaded from disk are there
+	missing := filepath.Join(t.TempDir(), "missing.tar")
+	data = []byte(`kindConfig: |
+  kind: Cluster
+  apiVersion: kind.x-k8s.io/v1alpha4
+loadDockerImages:
+  images:
+    - archive://` + missing + `
+`)
+
+	problems = Lint("config.yaml", data)
+	if len(problems) != 1 || !strings.Contains(problems[0].Message, "loadDockerImages.images[0]: archive "+missing) {
+		t.Errorf("Expected the missing archive to be reported, got: %v", problems)
+	}
+
+	c, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Did not expect Validate() to check the archive, got: %v", err)
+	}
+}
+
+func TestLintHelmValues(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "values.yaml"), []byte("replicas: 2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write values file: %v", err)
+	}
+
+	data := []byte(`kindConfig: |
+  kind: Cluster
+  apiVersion: kind.x-k8s.io/v1alpha4
+helmCharts:
+  - url: "oci://registry.example.com/charts/app"
+    release: "app"
+    namespace: "app"
+    valuesFiles:
+      - values.yaml
+      - missing.yaml
+      - https://example.com/values.yaml
+    set:
+      - replicas=3
+      - replicas
+    setString:
+      - image.tag=1234
+`)
+
+	problems := Lint(filepath.Join(dir, "config.yaml"), data)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %d: %v", len(problems), problems)
+	}
+	if problems[0].Line != 10 || !strings.HasPrefix(problems[0].Message, "helmCharts[0]: valuesFiles[1]:") {
+		t.Errorf("Unexpected first problem: %s", problems[0])
+	}
+	if problems[1].Line != 14 || problems[1].Message != `helmCharts[0]: set[1]: "replicas" is not in key=value form` {
+		t.Errorf("Unexpected second problem: %s", problems[1])
+	}
+}
+
+func TestLintHelmPathAndAuth(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "charts", "myapp"), 0755); err != nil {
+		t.Fatalf("Failed to create chart dir: %v", err)
+	}
+
+	data := []byte(`kindConfig: |
+  kind: Cluster
+  apiVersion: kind.x-k8s.io/v1alpha4
+helmCharts:
+  - path: charts/myapp
+    release: "myapp"
+    namespace: "dev"
+  - path: charts/missing
+    release: "missing"
+    namespace: "dev"
+  - release: "nothing"
+    namespace: "dev"
+  - url: "oci://registry.example.com/charts/app"
+    release: "private"
+    namespace: "dev"
+    auth:
+      passwordEnv: REGISTRY_PASSWORD
+      caFile: certs/ca.pem
+    postRenderer:
+      patches:
+        - path: patches/missing.yaml
+`)
+
+	problems := Lint(filepath.Join(dir, "config.yaml"), data)
+	if len(problems) != 5 {
+		t.Fatalf("Expected 2 problems, got %d: %v", len(problems), problems)
+	}
+	if problems[0].Line != 8 || !strings.HasPrefix(problems[0].Message, "helmCharts[1]: stat ") {
+		t.Errorf("Unexpected first problem: %s", problems[0])
+	}
+	if problems[1].Line != 11 || problems[1].Message != "helmCharts[2]: missing url or path" {
+		t.Errorf("Unexpected second problem: %s", problems[1])
+	}
+	if problems[2].Line != 17 || problems[2].Message != "helmCharts[3]: auth: a password needs a username" {
+		t.Errorf("Unexpected third problem: %s", problems[2])
+	}
+	if problems[3].Line != 18 || !strings.HasPrefix(problems[3].Message, "helmCharts[3]: auth: caFile: stat ") {
+		t.Errorf("Unexpected fourth problem: %s", problems[3])
+	}
+	if problems[4].Line != 21 || !strings.HasPrefix(problems[4].Message, "helmCharts[3]: postRenderer: patches[0]: stat ") {
+		t.Errorf("Unexpected fifth problem: %s", problems[4])
+	}
+}
+
+func TestLintHelmVerify(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "charts", "myapp"), 0755); err != nil {
+		t.Fatalf("Failed to create chart dir: %v", err)
+	}
+
+	data := []byte(`kindConfig: |
+  kind: Cluster
+  apiVersion: kind.x-k8s.io/v1alpha4
+helmCharts:
+  - path: charts/myapp
+    release: "myapp"
+    namespace: "dev"
+    verify: true
+    keyring: keys/missing.gpg
+  - url: "https://charts.example.com"
+    repo: "example"
+    chart: "app"
+    release: "app"
+    namespace: "dev"
+    keyring: keys/pubring.gpg
+    digest: "sha256:1234"
+  - url: "oci://registry.example.com/charts/app"
+    release: "oci"
+    namespace: "dev"
+    digest: "sha256:1234"
+`)
+
+	problems := Lint(filepath.Join(dir, "config.yaml"), data)
+	expected := []struct {
+		line   int
+		prefix string
+	}{
+		{8, "helmCharts[0]: only packaged charts can be verified"},
+		{9, "helmCharts[0]: keyring: stat "},
+		{15, "helmCharts[1]: keyring is only used with verify"},
+		{16, "helmCharts[1]: digest is only supported for OCI charts"},
+		{20, `helmCharts[2]: invalid digest "sha256:1234"`},
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expected), len(problems), problems)
+	}
+	for i, e := range expected {
+		if problems[i].Line != e.line || !strings.HasPrefix(problems[i].Message, e.prefix) {
+			t.Errorf("Expected problem %d to be line %d '%s...', got %s", i, e.line, e.prefix, problems[i])
+		}
+	}
+}
+
+func TestLintHelmDependencies(t *testing.T) {
+	data := []byte(`kindConfig: |
+  kind: Cluster
+  apiVersion: kind.x-k8s.io/v1alpha4
+helmCharts:
+  - url: "oci://registry.example.com/charts/a"
+    release: "a"
+    namespace: "a"
+    dependsOn:
+      - b
+      - nope
+  - url: "oci://registry.example.com/charts/b"
+    release: "b"
+    namespace: "b"
+    dependsOn: [a]
+`)
+
+	problems := Lint("config.yaml", data)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %d: %v", len(problems), problems)
+	}
+	if problems[0].Line != 9 || problems[0].Message != "helmCharts[0]: dependsOn: dependency cycle a -> b -> a" {
+		t.Errorf("Unexpected first problem: %s", problems[0])
+	}
+	if problems[1].Line != 10 || problems[1].Message != `helmCharts[0]: dependsOn[1]: unknown release "nope"` {
+		t.Errorf("Unexpected second problem: %s", problems[1])
+	}
+}
+
+func TestLintOutputs(t *testing.T) {
+	data := []byte(`kindConfig: |
+  kind: Cluster
+  apiVersion: kind.x-k8s.io/v1alpha4
+helmCharts:
+  - url: "oci://registry.example.com/charts/grafana"
+    release: "grafana"
+    namespace: "monitoring"
+    outputs:
+      - name: url
+        ingress: grafana
+        format: "https://%s"
+      - name: password
+        secret: grafana
+outputs:
+  - name: app
+    service: my-app
+    key: http
+`)
+
+	problems := Lint("config.yaml", data)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %d: %v", len(problems), problems)
+	}
+	if problems[0].Line != 12 || problems[0].Message != `helmCharts[0]: outputs[1]: output "password": key or jsonPath is required for a Secret` {
+		t.Errorf("Unexpected first problem: %s", problems[0])
+	}
+	if problems[1].Line != 15 || problems[1].Message != `outputs[0]: output "app": key is only used with secret and configMap` {
+		t.Errorf("Unexpected second problem: %s", problems[1])
+	}
+}
+
+func TestLintValidConfig(t *testing.T) {
+	data := []byte(`apiVersion: bekind.chernand.io/v1alpha1
+kind: BeKindConfig
+kindConfig: |
+  kind: Cluster
+  apiVersion: kind.x-k8s.io/v1alpha4
+  nodes:
+  - role: control-plane
+  - role: worker
+helmCharts:
+  - url: "oci://registry.example.com/charts/app"
+    release: "app"
+    namespace: "app"
+    valuesObject:
+      anything:
+        goes: here
+postInstallActions:
+  - action: delete
+    kind: Pod
+    namespace: default
+    labelSelector:
+      app: cleanup
+`)
+
+	if problems := Lint("config.yaml", data); len(problems) != 0 {
+		t.Errorf("Expected no problems, got: %v", problems)
+	}
+}
+
+func TestLintMissingKindConfig(t *testing.T) {
+	problems := Lint("config.yaml", []byte(`kindImageVersion: "kindest/node:v1.34.0"`))
+	if len(problems) != 1 || problems[0].Message != "kindConfig is required" {
+		t.Errorf("Expected only 'kindConfig is required', got: %v", problems)
+	}
+}
+
+func TestLintBadYAML(t *testing.T) {
+	problems := Lint("config.yaml", []byte("kindConfig: |\n  kind: Cluster\nhelmCharts: [\n"))
+	if len(problems) == 0 {
+		t.Fatal("Expected a problem for malformed YAML")
+	}
+	if problems[0].Line == 0 {
+		t.Errorf("Expected the YAML error to have a line number, got: %v", problems[0])
+	}
+}
+
+func TestLintFile(t *testing.T) {
+	problems := LintFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	if len(problems) != 1 {
+		t.Errorf("Expected a single problem for a missing file, got: %v", problems)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("kindConfig: \"kind: Cluster\\napiVersion: kind.x-k8s.io/v1alpha4\\n\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	if problems := LintFile(path); len(problems) != 0 {
+		t.Errorf("Expected no problems, got: %v", problems)
+	}
+}
+
+func TestProblemString(t *testing.T) {
+	p := Problem{File: "config.yaml", Line: 3, Message: "bad"}
+	if p.String() != "config.yaml:3: bad" {
+		t.Errorf("Expected 'config.yaml:3: bad', got '%s'", p.String())
+	}
+
+	p.Line = 0
+	if p.String() != "config.yaml: bad" {
+		t.Errorf("Expected 'config.yaml: bad', got '%s'", p.String())
+	}
+}
+
+func TestPostInstallActionValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		action      PostInstallAction
+		expectError bool
+	}{
+		{"restart deployment", PostInstallAction{Action: "restart", Kind: "Deployment", Name: "test"}, false},
+		{"delete pods by label", PostInstallAction{Action: "delete", Kind: "Pod", LabelSelector: map[string]string{"app": "test"}}, false},
+		{"missing action", PostInstallAction{Kind: "Deployment", Name: "test"}, true},
+		{"missing name and labelSelector", PostInstallAction{Action: "restart", Kind: "Deployment"}, true},
+		{"unsupported action", PostInstallAction{Action: "update", Kind: "Deployment", Name: "test"}, true},
+		{"delete deployment", PostInstallAction{Action: "delete", Kind: "Deployment", Name: "test"}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.action.Validate()
+			if tc.expectError && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("Did not expect error, got: %v", err)
+			}
+		})
+	}
+}
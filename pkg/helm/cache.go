@@ -0,0 +1,222 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/christianh814/bekind/pkg/config"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/downloader"
+)
+
+// Offline makes charts install from the chart cache, without adding or updating any repos
+var Offline bool
+
+// ChartCache is where Prefetch saves charts for installing them offline
+var ChartCache = filepath.Join(Home, "charts")
+
+// cacheMu stops charts that are prefetched at the same time from writing the index together
+var cacheMu sync.Mutex
+
+// CachedChart is a chart saved in the chart cache
+type CachedChart struct {
+	// URL, Chart and Version are what the chart is looked up by, as they are in the config.
+	// URL is the OCI reference for OCI charts, including the digest if it has one.
+	URL     string `yaml:"url"`
+	Chart   string `yaml:"chart,omitempty"`
+	Version string `yaml:"version,omitempty"`
+	// Name and ChartVersion are from the chart itself
+	Name         string `yaml:"name"`
+	ChartVersion string `yaml:"chartVersion"`
+	// Digest is the sha256 digest of the packaged chart, checked before it's installed
+	Digest string `yaml:"digest"`
+	File   string `yaml:"file"`
+}
+
+// chartIndex is the list of charts in the chart cache
+type chartIndex struct {
+	Charts []CachedChart `yaml:"charts"`
+}
+
+// Prefetch downloads the given chart into the chart cache, so it can be installed with Offline set
+func Prefetch(h config.HelmChart) (*CachedChart, error) {
+	if h.IsLocal() {
+		return nil, errors.Errorf("local chart %s doesn't need to be prefetched", h.Path)
+	}
+
+	// Add/update the repo for the chart
+	if err := prepare(h); err != nil {
+		return nil, err
+	}
+
+	client := action.NewInstall(new(action.Configuration))
+	client.Version = h.Version
+	client.Verify = h.Verify
+	client.Keyring = h.KeyringPath()
+
+	cp, err := getChartPath(h, client, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	chartRequested, err := loader.Load(cp)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := fileDigest(cp)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := cacheKey(h)
+	cached.Name = chartRequested.Metadata.Name
+	cached.ChartVersion = chartRequested.Metadata.Version
+	cached.Digest = digest
+	cached.File = fmt.Sprintf("%s-%s-%s.tgz", cached.Name, cached.ChartVersion, digest[len("sha256:"):][:12])
+
+	if err := os.MkdirAll(ChartCache, 0755); err != nil {
+		return nil, err
+	}
+	if err := copyFile(cp, filepath.Join(ChartCache, cached.File)); err != nil {
+		return nil, err
+	}
+	// Verified charts need their provenance file to be verified again offline
+	if h.Verify {
+		if err := copyFile(cp+".prov", filepath.Join(ChartCache, cached.File+".prov")); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := addToIndex(cached); err != nil {
+		return nil, err
+	}
+
+	return &cached, nil
+}
+
+// cachedChartPath returns the path of the chart in the chart cache, after checking its digest
+func cachedChartPath(h config.HelmChart, client *action.Install) (string, error) {
+	index, err := loadIndex()
+	if err != nil {
+		return "", err
+	}
+
+	key := cacheKey(h)
+	var cached *CachedChart
+	for i, c := range index.Charts {
+		if c.URL == key.URL && c.Chart == key.Chart && c.Version == key.Version {
+			cached = &index.Charts[i]
+			break
+		}
+	}
+	if cached == nil {
+		return "", errors.Errorf("chart %s version %q is not in the chart cache, run \"bekind prefetch\" while online first", h.Source(), h.Version)
+	}
+
+	path := filepath.Join(ChartCache, cached.File)
+	digest, err := fileDigest(path)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read cached chart")
+	}
+	if digest != cached.Digest {
+		return "", errors.Errorf("cached chart %s has digest %s, expected %s, run \"bekind prefetch\" again", cached.File, digest, cached.Digest)
+	}
+
+	if client.Verify {
+		if _, err := downloader.VerifyChart(path, client.Keyring); err != nil {
+			return "", err
+		}
+	}
+
+	return path, nil
+}
+
+// cacheKey returns the fields the chart is looked up by in the chart cache
+func cacheKey(h config.HelmChart) CachedChart {
+	if h.IsOCI() {
+		return CachedChart{URL: ociRef(h), Version: h.Version}
+	}
+
+	return CachedChart{URL: h.Url, Chart: h.Chart, Version: h.Version}
+}
+
+// loadIndex reads the chart cache index, an empty index is returned if there isn't one yet
+func loadIndex() (*chartIndex, error) {
+	index := &chartIndex{}
+	data, err := os.ReadFile(filepath.Join(ChartCache, "index.yaml"))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, index); err != nil {
+		return nil, errors.Wrap(err, "failed to read chart cache index")
+	}
+
+	return index, nil
+}
+
+// addToIndex adds the chart to the chart cache index, replacing the chart with the same key
+func addToIndex(cached CachedChart) error {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	index, err := loadIndex()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i, c := range index.Charts {
+		if c.URL == cached.URL && c.Chart == cached.Chart && c.Version == cached.Version {
+			index.Charts[i] = cached
+			replaced = true
+		}
+	}
+	if !replaced {
+		index.Charts = append(index.Charts, cached)
+	}
+
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(ChartCache, "index.yaml"), data, 0644)
+}
+
+// fileDigest returns the sha256 digest of the file
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyFile copies src to dst, replacing dst if it's there
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dst, data, 0644)
+}
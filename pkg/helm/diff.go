@@ -0,0 +1,259 @@
+package helm
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/christianh814/bekind/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/client-go/discovery"
+)
+
+// How an object in a release would change
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// ReleaseDiff is how a release on the cluster would change if the chart was installed
+type ReleaseDiff struct {
+	Release   string
+	Namespace string
+	// Installed is set when the release is already on the cluster
+	Installed bool
+	Objects   []ObjectDiff
+}
+
+// ObjectDiff is how a single object in a release would change
+type ObjectDiff struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Change    string
+	// Diff is a unified diff from the live manifest to the rendered one
+	Diff string
+}
+
+// String returns the kind, namespace and name of the object
+func (o ObjectDiff) String() string {
+	if o.Namespace == "" {
+		return o.Kind + "/" + o.Name
+	}
+
+	return o.Kind + "/" + o.Namespace + "/" + o.Name
+}
+
+// Diff renders the given helm chart and compares it with the manifest of the release on the
+// cluster in KubeContext. The chart's repo is added/updated but nothing is changed on the cluster.
+func Diff(h config.HelmChart) (*ReleaseDiff, error) {
+	// Add/update the repo for the chart
+	if err := prepare(h); err != nil {
+		return nil, err
+	}
+
+	settings := chartSettings(h.Namespace)
+
+	actionConfig := new(action.Configuration)
+	if err := actionConfig.Init(settings.RESTClientGetter(), settings.Namespace(), os.Getenv("HELM_DRIVER"), debug); err != nil {
+		return nil, err
+	}
+
+	caps, err := clusterCapabilities(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := render(h, settings, caps)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := action.NewGet(actionConfig).Run(h.Release)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, err
+	}
+
+	d := &ReleaseDiff{
+		Release:   h.Release,
+		Namespace: settings.Namespace(),
+		Installed: current != nil,
+	}
+	live := ""
+	if current != nil {
+		live = current.Manifest
+	}
+	d.Objects, err = diffManifests(live, rendered)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// clusterCapabilities returns the Kubernetes version and API versions of the cluster
+func clusterCapabilities(settings *cli.EnvSettings) (*chartutil.Capabilities, error) {
+	dc, err := settings.RESTClientGetter().ToDiscoveryClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get Kubernetes discovery client")
+	}
+	dc.Invalidate()
+
+	kubeVersion, err := dc.ServerVersion()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get server version from Kubernetes")
+	}
+	kv, err := chartutil.ParseKubeVersion(kubeVersion.GitVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like helm, an orphaned API service doesn't stop the rest of the APIs being found
+	apiVersions, err := action.GetVersionSet(dc)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, errors.Wrap(err, "could not get apiVersions from Kubernetes")
+	}
+
+	return &chartutil.Capabilities{KubeVersion: *kv, APIVersions: apiVersions}, nil
+}
+
+// render returns the manifest the chart would be installed with. It's rendered client side,
+// like helm template, so the release on the cluster isn't looked at. The chart is rendered for
+// the Kubernetes version and APIs in caps, so kubeVersion constraints and templates that check
+// .Capabilities come out the way they would on the cluster. Helm's defaults are used without caps.
+func render(h config.HelmChart, settings *cli.EnvSettings, caps *chartutil.Capabilities) (string, error) {
+	client := action.NewInstall(new(action.Configuration))
+	client.DryRun = true
+	client.ClientOnly = true
+	if caps != nil {
+		client.KubeVersion = &caps.KubeVersion
+		client.APIVersions = caps.APIVersions
+	}
+	client.ReleaseName = h.Release
+	client.Namespace = settings.Namespace()
+	client.Version = h.Version
+	client.Verify = h.Verify
+	client.Keyring = h.KeyringPath()
+	client.SkipCRDs = h.SkipCRDs
+	client.DisableHooks = h.DisableHooks
+
+	cp, err := getChartPath(h, client, settings)
+	if err != nil {
+		return "", err
+	}
+
+	chartRequested, err := loader.Load(cp)
+	if err != nil {
+		return "", err
+	}
+	if ok, err := isChartInstallable(chartRequested); !ok {
+		return "", err
+	}
+
+	vals, err := mergeValues(h, getter.All(settings))
+	if err != nil {
+		return "", err
+	}
+
+	client.PostRenderer, err = postRenderer(h)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := client.Run(chartRequested, vals)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to render release %s", h.Release)
+	}
+
+	return rel.Manifest, nil
+}
+
+// diffManifests compares the objects in two manifests, returning the ones that differ
+// sorted by kind, namespace and name
+func diffManifests(live, rendered string) ([]ObjectDiff, error) {
+	before, err := manifestObjects(live)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read live manifest")
+	}
+	after, err := manifestObjects(rendered)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read rendered manifest")
+	}
+
+	keys := make(map[ObjectDiff]bool)
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+
+	var diffs []ObjectDiff
+	for k := range keys {
+		a, inBefore := before[k]
+		b, inAfter := after[k]
+		switch {
+		case !inBefore:
+			k.Change = ChangeAdded
+		case !inAfter:
+			k.Change = ChangeRemoved
+		case a != b:
+			k.Change = ChangeChanged
+		default:
+			continue
+		}
+
+		k.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(a),
+			B:        difflib.SplitLines(b),
+			FromFile: "live",
+			ToFile:   "rendered",
+			Context:  3,
+		})
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, k)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].String() < diffs[j].String()
+	})
+
+	return diffs, nil
+}
+
+// manifestObjects splits a manifest into its objects, keyed by kind, namespace and name
+func manifestObjects(manifest string) (map[ObjectDiff]string, error) {
+	objects := make(map[ObjectDiff]string)
+	for _, m := range releaseutil.SplitManifests(manifest) {
+		var head struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name      string `yaml:"name"`
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(m), &head); err != nil {
+			return nil, err
+		}
+		if head.Kind == "" {
+			continue
+		}
+
+		key := ObjectDiff{Kind: head.Kind, Namespace: head.Metadata.Namespace, Name: head.Metadata.Name}
+		objects[key] = strings.TrimSpace(m) + "\n"
+	}
+
+	return objects, nil
+}
@@ -2,9 +2,16 @@ package helm
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +20,7 @@ import (
 
 	"gopkg.in/yaml.v2"
 
+	"github.com/christianh814/bekind/pkg/config"
 	"github.com/gofrs/flock"
 	"github.com/pkg/errors"
 
@@ -23,36 +31,171 @@ import (
 	"helm.sh/helm/v3/pkg/cli/values"
 	"helm.sh/helm/v3/pkg/downloader"
 	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/postrender"
 	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"helm.sh/helm/v3/pkg/strvals"
 )
 
-var settings *cli.EnvSettings
+// Home is where bekind keeps its own helm repository config and cache, so the
+// user's helm setup isn't changed
+var Home = filepath.Join(os.Getenv("HOME"), ".bekind", "helm")
 
-func Install(namespace, url, repoName, chartName, releaseName, version string, wait bool, valuesObject map[string]interface{}) error {
+// settings are shared by all charts, InstallChart makes a copy for the chart's namespace
+var settings = newSettings()
 
-	// Set the namespace
-	os.Setenv("HELM_NAMESPACE", namespace)
+// KubeContext is the kubeconfig context charts are installed into and releases are read from.
+// The current context is used when it's empty.
+var KubeContext string
 
-	settings = cli.New()
+var (
+	// repoMu stops charts that are installed at the same time from updating the repos together
+	repoMu sync.Mutex
+	// updatedRepos are the repos that were already added/updated during this run
+	updatedRepos = make(map[string]bool)
 
-	// No need to add/update if using OCI
-	if !strings.HasPrefix(url, "oci://") {
+	// chartMu guards chartLocks, which stop releases of the same chart that are installed
+	// at the same time from downloading it to the same place in the cache together
+	chartMu    sync.Mutex
+	chartLocks = make(map[string]*sync.Mutex)
+)
 
-		// Add helm repo
-		if err := RepoAdd(repoName, url); err != nil {
-			return err
+// What was done with a release by InstallChart
+const (
+	ActionInstalled = "installed"
+	ActionUpgraded  = "upgraded"
+	ActionUnchanged = "unchanged"
+)
+
+// Result is what InstallChart did with a release
+type Result struct {
+	Release         string
+	Namespace       string
+	Action          string
+	Chart           string
+	Version         string
+	PreviousVersion string
+	ChangedValues   []string
+	// TemplatesChanged is set when the chart changed without a new version, like a local chart
+	TemplatesChanged bool
+	// ManifestsChanged is set when only the post renderer changed the manifests
+	ManifestsChanged bool
+}
+
+// String summarizes what was done with the release
+func (r Result) String() string {
+	summary := fmt.Sprintf("%s/%s: %s %s %s", r.Namespace, r.Release, r.Action, r.Chart, r.Version)
+	if r.Action != ActionUpgraded {
+		return summary
+	}
+
+	if r.PreviousVersion != r.Version {
+		summary = fmt.Sprintf("%s/%s: %s %s %s -> %s", r.Namespace, r.Release, r.Action, r.Chart, r.PreviousVersion, r.Version)
+	}
+	if len(r.ChangedValues) != 0 {
+		summary += fmt.Sprintf(", values changed: %s", strings.Join(r.ChangedValues, ", "))
+	}
+	if r.TemplatesChanged && r.PreviousVersion == r.Version {
+		summary += ", templates changed"
+	}
+	if r.ManifestsChanged {
+		summary += ", manifests changed"
+	}
+
+	return summary
+}
+
+// ChartInfo is what a helm chart entry resolves to before it's installed
+type ChartInfo struct {
+	Name       string
+	Version    string
+	AppVersion string
+	Values     map[string]interface{}
+}
+
+// Install adds the chart's repo (if needed) and installs or upgrades the given helm chart
+func Install(h config.HelmChart) (*Result, error) {
+	// Add/update the repo for the chart
+	if err := prepare(h); err != nil {
+		return nil, err
+	}
+
+	// Install charts
+	result, err := InstallChart(h)
+	if err != nil {
+		return nil, err
+	}
+
+	// if we are here, everything is ok
+	return result, nil
+}
+
+// Resolve locates the given helm chart and returns the version and values that would be
+// installed. The chart's repo is added/updated but nothing is done on the cluster.
+func Resolve(h config.HelmChart) (*ChartInfo, error) {
+	// Add/update the repo for the chart
+	if err := prepare(h); err != nil {
+		return nil, err
+	}
+
+	// The install action is only used to locate the chart, so it doesn't need a cluster
+	client := action.NewInstall(new(action.Configuration))
+	client.Version = h.Version
+	client.Verify = h.Verify
+	client.Keyring = h.KeyringPath()
+
+	cp, err := getChartPath(h, client, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	chartRequested, err := loader.Load(cp)
+	if err != nil {
+		return nil, err
+	}
+
+	vals, err := mergeValues(h, getter.All(settings))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChartInfo{
+		Name:       chartRequested.Metadata.Name,
+		Version:    chartRequested.Metadata.Version,
+		AppVersion: chartRequested.Metadata.AppVersion,
+		Values:     vals,
+	}, nil
+}
+
+// prepare adds/updates the chart's repo
+func prepare(h config.HelmChart) error {
+	// No need to add/update if using OCI or a local chart, or installing from the chart cache
+	if !h.IsOCI() && !h.IsLocal() && !Offline {
+		repoMu.Lock()
+		defer repoMu.Unlock()
+
+		// Charts from the same repo only need it updated once
+		if updatedRepos[h.Repo] {
+			return nil
 		}
 
-		// Update charts from the helm repo
-		if err := RepoUpdate(); err != nil {
+		// Add helm repo, with the chart's credentials
+		entry, err := repoEntry(h)
+		if err != nil {
+			return err
+		}
+		if err := addRepo(entry); err != nil {
 			return err
 		}
-	}
 
-	// Install charts
-	if err := InstallChart(releaseName, repoName, chartName, version, url, wait, valuesObject); err != nil {
-		return err
+		// Update charts from the helm repo. The credentials aren't in the repo file,
+		// so the repo is updated from the entry instead.
+		if err := updateRepo(entry); err != nil {
+			return err
+		}
+		updatedRepos[h.Repo] = true
 	}
 
 	// if we are here, everything is ok
@@ -61,6 +204,35 @@ func Install(namespace, url, repoName, chartName, releaseName, version string, w
 
 // RepoAdd adds repo with given name and url
 func RepoAdd(name, url string) error {
+	return addRepo(&repo.Entry{Name: name, URL: url})
+}
+
+// repoEntry returns the repo entry for the chart, including how to log in to it
+func repoEntry(h config.HelmChart) (*repo.Entry, error) {
+	entry := &repo.Entry{
+		Name: h.Repo,
+		URL:  h.Url,
+	}
+	if h.Auth == nil {
+		return entry, nil
+	}
+
+	username, password, err := h.Auth.Credentials()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get credentials for repo %q", h.Repo)
+	}
+	entry.Username = username
+	entry.Password = password
+	entry.CAFile = h.Auth.CAFile
+	entry.InsecureSkipTLSverify = h.Auth.InsecureSkipTLSVerify
+
+	return entry, nil
+}
+
+// addRepo adds the repo entry, replacing a repo with the same name if it changed. The entry's
+// credentials are only used to reach the repo, they're left out of the repo file.
+func addRepo(c *repo.Entry) error {
+	name, url := c.Name, c.URL
 	repoFile := settings.RepositoryConfig
 
 	//Ensure the file directory exists as it is required for file locking
@@ -91,37 +263,53 @@ func RepoAdd(name, url string) error {
 		return err
 	}
 
-	if f.Has(name) {
-		return nil
-	}
+	stored := *c
+	stored.Username, stored.Password = "", ""
 
-	c := repo.Entry{
-		Name: name,
-		URL:  url,
+	// A repo with the same name but another URL or TLS settings is replaced
+	if e := f.Get(name); e != nil && *e == stored {
+		return nil
 	}
 
-	r, err := repo.NewChartRepository(&c, getter.All(settings))
+	r, err := repo.NewChartRepository(c, getter.All(settings))
 	if err != nil {
 		return err
 	}
+	r.CachePath = settings.RepositoryCache
 
 	if _, err := r.DownloadIndexFile(); err != nil {
 		err := errors.Wrapf(err, "looks like %q is not a valid chart repository or cannot be reached", url)
 		return err
 	}
 
-	f.Update(&c)
+	f.Update(&stored)
+
+	if err := f.WriteFile(repoFile, 0600); err != nil {
+		return err
+	}
+
+	// if we are here, everything is ok
+	return nil
+}
 
-	if err := f.WriteFile(repoFile, 0644); err != nil {
+// updateRepo updates charts from the helm repo entry
+func updateRepo(c *repo.Entry) error {
+	r, err := repo.NewChartRepository(c, getter.All(settings))
+	if err != nil {
 		return err
 	}
+	r.CachePath = settings.RepositoryCache
+
+	if _, err := r.DownloadIndexFile(); err != nil {
+		log.Infof("...Unable to get an update from the %q chart repository (%s):\n\t%s\n", c.Name, c.URL, err)
+	}
 
 	// if we are here, everything is ok
 	return nil
 }
 
-// RepoUpdate updates charts for all helm repos
-func RepoUpdate() error {
+// RepoUpdate updates charts for the named helm repos, or all of them if no names are given
+func RepoUpdate(names ...string) error {
 	repoFile := settings.RepositoryConfig
 
 	f, err := repo.LoadFile(repoFile)
@@ -130,10 +318,14 @@ func RepoUpdate() error {
 	}
 	var repos []*repo.ChartRepository
 	for _, cfg := range f.Repositories {
+		if len(names) != 0 && !slices.Contains(names, cfg.Name) {
+			continue
+		}
 		r, err := repo.NewChartRepository(cfg, getter.All(settings))
 		if err != nil {
 			return err
 		}
+		r.CachePath = settings.RepositoryCache
 		repos = append(repos, r)
 	}
 
@@ -153,11 +345,14 @@ func RepoUpdate() error {
 	return nil
 }
 
-// InstallChart
-func InstallChart(name, repo, chart, version, url string, wait bool, valuesObject map[string]interface{}) error {
+// InstallChart installs the given helm chart, or upgrades the release if it's already installed.
+// Releases that already have the same chart version and values are left alone.
+func InstallChart(h config.HelmChart) (*Result, error) {
+	settings := chartSettings(h.Namespace)
+
 	actionConfig := new(action.Configuration)
 	if err := actionConfig.Init(settings.RESTClientGetter(), settings.Namespace(), os.Getenv("HELM_DRIVER"), debug); err != nil {
-		return err
+		return nil, err
 	}
 	client := action.NewInstall(actionConfig)
 
@@ -166,39 +361,35 @@ func InstallChart(name, repo, chart, version, url string, wait bool, valuesObjec
 	}
 
 	// Set version if provided
-	if version != "" {
-		client.Version = version
+	if h.Version != "" {
+		client.Version = h.Version
 	}
+	client.Verify = h.Verify
+	client.Keyring = h.KeyringPath()
 
-	client.ReleaseName = name
+	client.ReleaseName = h.Release
 
 	// Get the chart path
-	cp, err := getChartPath(url, repo, chart, client, settings)
+	cp, err := getChartPath(h, client, settings)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	p := getter.All(settings)
-	valueOpts := &values.Options{}
-	vals, err := valueOpts.MergeValues(p)
+	vals, err := mergeValues(h, p)
 	if err != nil {
-		return err
-	}
-
-	// Merge values from the valuesObject
-	for k, v := range valuesObject {
-		vals[k] = v
+		return nil, err
 	}
 
 	// Check chart dependencies to make sure all are present in /charts
 	chartRequested, err := loader.Load(cp)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	validInstallableChart, err := isChartInstallable(chartRequested)
 	if !validInstallableChart {
-		return err
+		return nil, err
 	}
 
 	if req := chartRequested.Metadata.Dependencies; req != nil {
@@ -216,28 +407,294 @@ func InstallChart(name, repo, chart, version, url string, wait bool, valuesObjec
 					RegistryClient:   client.GetRegistryClient(),
 				}
 				if err := man.Update(); err != nil {
-					return err
+					return nil, err
 				}
 			} else {
-				return err
+				return nil, err
 			}
 		}
 	}
 
-	// set and have helm create the namespace
-	client.Namespace = settings.Namespace()
-	client.CreateNamespace = true
-	client.Wait = wait
-	// TODO: Make this configurable
-	client.Timeout = 180 * time.Second
+	result := &Result{
+		Release:   h.Release,
+		Namespace: settings.Namespace(),
+		Chart:     chartRequested.Metadata.Name,
+		Version:   chartRequested.Metadata.Version,
+	}
+
+	// Check if the release is already there
+	current, err := action.NewGet(actionConfig).Run(h.Release)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, err
+	}
+
+	timeout, err := h.TimeoutDuration()
+	if err != nil {
+		return nil, err
+	}
+
+	pr, err := postRenderer(h)
+	if err != nil {
+		return nil, err
+	}
+
+	if current == nil {
+		// set and have helm create the namespace, unless the chart says not to
+		client.Namespace = settings.Namespace()
+		client.CreateNamespace = h.ShouldCreateNamespace()
+		client.Wait = h.ShouldWait()
+		client.WaitForJobs = h.WaitForJobs
+		client.Atomic = h.Atomic
+		client.SkipCRDs = h.SkipCRDs
+		client.DisableHooks = h.DisableHooks
+		client.Timeout = timeout
+		client.PostRenderer = pr
+
+		if _, err := client.Run(chartRequested, vals); err != nil {
+			return nil, err
+		}
+
+		result.Action = ActionInstalled
+		return result, nil
+	}
+
+	// Work out what changed since the release was last installed
+	if current.Chart != nil && current.Chart.Metadata != nil {
+		result.PreviousVersion = current.Chart.Metadata.Version
+	}
+	result.ChangedValues, err = changedValues(current.Config, vals)
+	if err != nil {
+		return nil, err
+	}
+
+	result.TemplatesChanged = templatesChanged(current.Chart, chartRequested)
+
+	deployed := current.Info != nil && current.Info.Status == release.StatusDeployed
+	if deployed && result.PreviousVersion == result.Version && len(result.ChangedValues) == 0 && !result.TemplatesChanged {
+		// The post renderer can change the manifests without anything else changing, so
+		// render them to find out
+		if pr != nil {
+			upgrade := newUpgrade(actionConfig, h, settings.Namespace(), timeout, pr)
+			upgrade.DryRun = true
+			upgrade.DryRunOption = "server"
+			rel, err := upgrade.Run(h.Release, chartRequested, vals)
+			if err != nil {
+				return nil, err
+			}
+			result.ManifestsChanged = rel.Manifest != current.Manifest
+		}
+
+		if !result.ManifestsChanged {
+			result.Action = ActionUnchanged
+			return result, nil
+		}
+	}
+
+	upgrade := newUpgrade(actionConfig, h, settings.Namespace(), timeout, pr)
+	if _, err := upgrade.Run(h.Release, chartRequested, vals); err != nil {
+		return nil, err
+	}
+
+	result.Action = ActionUpgraded
+	return result, nil
+}
+
+// newUpgrade returns an upgrade action with the chart's options
+func newUpgrade(actionConfig *action.Configuration, h config.HelmChart, namespace string, timeout time.Duration, pr postrender.PostRenderer) *action.Upgrade {
+	upgrade := action.NewUpgrade(actionConfig)
+	upgrade.Install = true
+	upgrade.Namespace = namespace
+	upgrade.Wait = h.ShouldWait()
+	upgrade.WaitForJobs = h.WaitForJobs
+	upgrade.Atomic = h.Atomic
+	upgrade.SkipCRDs = h.SkipCRDs
+	upgrade.DisableHooks = h.DisableHooks
+	upgrade.Timeout = timeout
+	upgrade.PostRenderer = pr
+
+	return upgrade
+}
+
+// newSettings returns helm settings that use the repository config and cache in Home
+func newSettings() *cli.EnvSettings {
+	s := cli.New()
+	s.RepositoryConfig = filepath.Join(Home, "repositories.yaml")
+	s.RepositoryCache = filepath.Join(Home, "repository")
+
+	return s
+}
+
+// chartSettings returns helm settings for the given namespace, using the shared repo settings.
+// Each chart gets its own settings so charts in different namespaces can be installed at the same time.
+func chartSettings(namespace string) *cli.EnvSettings {
+	s := cli.New()
+	s.SetNamespace(namespace)
+	if KubeContext != "" {
+		s.KubeContext = KubeContext
+	}
+	s.RepositoryConfig = settings.RepositoryConfig
+	s.RepositoryCache = settings.RepositoryCache
+	s.RegistryConfig = settings.RegistryConfig
+
+	return s
+}
+
+// templatesChanged returns true if the templates of the charts, or of their subcharts, differ
+func templatesChanged(a, b *chart.Chart) bool {
+	if a == nil || b == nil {
+		return a != b
+	}
+
+	templates := func(c *chart.Chart) map[string]string {
+		m := make(map[string]string)
+		for _, t := range c.Templates {
+			m[t.Name] = string(t.Data)
+		}
+		return m
+	}
+	if !reflect.DeepEqual(templates(a), templates(b)) {
+		return true
+	}
+
+	deps := make(map[string]*chart.Chart)
+	for _, d := range a.Dependencies() {
+		deps[d.Name()] = d
+	}
+	if len(deps) != len(b.Dependencies()) {
+		return true
+	}
+	for _, d := range b.Dependencies() {
+		if templatesChanged(deps[d.Name()], d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// changedValues returns the dotted paths of the values that differ between two sets of values
+func changedValues(previous, current map[string]interface{}) ([]string, error) {
+	// Stored values come back from JSON, so compare both sides as JSON
+	var prev, cur map[string]interface{}
+	if err := normalizeValues(previous, &prev); err != nil {
+		return nil, err
+	}
+	if err := normalizeValues(current, &cur); err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	diffValues("", prev, cur, &changed)
+	sort.Strings(changed)
+
+	return changed, nil
+}
 
-	_, err = client.Run(chartRequested, vals)
+// normalizeValues round trips values through JSON
+func normalizeValues(in map[string]interface{}, out *map[string]interface{}) error {
+	data, err := json.Marshal(in)
 	if err != nil {
 		return err
 	}
 
-	// if we are here, everything is ok
-	return nil
+	return json.Unmarshal(data, out)
+}
+
+// diffValues adds the paths where a and b differ to changed, descending into maps
+func diffValues(prefix string, a, b map[string]interface{}, changed *[]string) {
+	keys := make(map[string]bool)
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+
+	for k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+
+		am, aIsMap := a[k].(map[string]interface{})
+		bm, bIsMap := b[k].(map[string]interface{})
+		if aIsMap && bIsMap {
+			diffValues(path, am, bm, changed)
+			continue
+		}
+
+		if !reflect.DeepEqual(a[k], b[k]) {
+			*changed = append(*changed, path)
+		}
+	}
+}
+
+// mergeValues returns the values to install the chart with. Like Helm, later values win:
+// valuesFiles in order, then valuesObject, then set, then setString.
+func mergeValues(h config.HelmChart, p getter.Providers) (map[string]interface{}, error) {
+	valueOpts := &values.Options{
+		ValueFiles: h.ValuesFiles,
+	}
+	vals, err := valueOpts.MergeValues(p)
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge values from the valuesObject. It's copied first so setting values below
+	// doesn't change the config.
+	vals = mergeMaps(vals, copyValues(h.ValuesObject).(map[string]interface{}))
+
+	for _, v := range h.Set {
+		if err := strvals.ParseInto(v, vals); err != nil {
+			return nil, errors.Wrapf(err, "failed parsing set data %q", v)
+		}
+	}
+	for _, v := range h.SetString {
+		if err := strvals.ParseIntoString(v, vals); err != nil {
+			return nil, errors.Wrapf(err, "failed parsing setString data %q", v)
+		}
+	}
+
+	return vals, nil
+}
+
+// mergeMaps deep merges b into a, values in b win
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if v, ok := v.(map[string]interface{}); ok {
+			if bv, ok := out[k].(map[string]interface{}); ok {
+				out[k] = mergeMaps(bv, v)
+				continue
+			}
+		}
+		out[k] = v
+	}
+
+	return out
+}
+
+// copyValues returns a deep copy of the maps and slices in v
+func copyValues(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			out[k] = copyValues(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			out[i] = copyValues(val)
+		}
+		return out
+	default:
+		return v
+	}
 }
 
 func isChartInstallable(ch *chart.Chart) (bool, error) {
@@ -252,17 +709,135 @@ func debug(format string, v ...interface{}) {
 	format = fmt.Sprintf("[debug] %s\n", format)
 }
 
-// getChartPath returns the path to the chart taking OCI into account
-func getChartPath(url, repo, chart string, client *action.Install, settings *cli.EnvSettings) (string, error) {
-	if strings.HasPrefix(url, "oci://") {
-		rc, err := registry.NewClient()
+// getChartPath returns the path to the chart taking OCI, local and cached charts into account
+func getChartPath(h config.HelmChart, client *action.Install, settings *cli.EnvSettings) (string, error) {
+	if h.IsLocal() {
+		// Local charts are loaded as they are, a directory or a packaged .tgz
+		fi, err := os.Stat(h.Path)
+		if err != nil {
+			return "", errors.Wrap(err, "chart path not found")
+		}
+		if client.Verify {
+			if fi.IsDir() {
+				return "", errors.Errorf("only packaged charts can be verified, %s is a directory", h.Path)
+			}
+			if _, err := downloader.VerifyChart(h.Path, client.Keyring); err != nil {
+				return "", err
+			}
+		}
+		return h.Path, nil
+	}
+
+	// Charts were downloaded by Prefetch when offline
+	if Offline {
+		return cachedChartPath(h, client)
+	}
+
+	// Releases of the same chart wait for each other to download it
+	unlock := lockChart(fmt.Sprintf("%s %s %s", h.Url, h.Chart, client.Version))
+	defer unlock()
+
+	if h.IsOCI() {
+		rc, err := newRegistryClient(h, settings)
 		if err != nil {
 			return "", err
 		}
 		client.SetRegistryClient(rc)
-		return client.ChartPathOptions.LocateChart(url, settings)
+
+		return client.ChartPathOptions.LocateChart(ociRef(h), settings)
 	} else {
-		return client.ChartPathOptions.LocateChart(fmt.Sprintf("%s/%s", repo, chart), settings)
+		// The repo file has no credentials, so they're given to the download instead
+		if h.Auth != nil {
+			username, password, err := h.Auth.Credentials()
+			if err != nil {
+				return "", errors.Wrapf(err, "failed to get credentials for repo %q", h.Repo)
+			}
+			client.ChartPathOptions.Username = username
+			client.ChartPathOptions.Password = password
+		}
+
+		return client.ChartPathOptions.LocateChart(fmt.Sprintf("%s/%s", h.Repo, h.Chart), settings)
+	}
+
+}
+
+// lockChart locks the chart with the given key and returns the func that unlocks it
+func lockChart(key string) func() {
+	chartMu.Lock()
+	l, ok := chartLocks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		chartLocks[key] = l
+	}
+	chartMu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// ociRef returns the reference to pull an OCI chart with. Pulling by digest makes sure we get
+// exactly that chart, Helm checks the version matches it too.
+func ociRef(h config.HelmChart) string {
+	if h.Digest == "" {
+		return h.Url
+	}
+
+	return h.Url + "@" + h.Digest
+}
+
+// newRegistryClient returns a registry client for the chart's OCI registry. Credentials from the
+// chart's auth are used for every request instead of logging in, so they aren't saved anywhere.
+func newRegistryClient(h config.HelmChart, settings *cli.EnvSettings) (*registry.Client, error) {
+	opts := []registry.ClientOption{
+		registry.ClientOptCredentialsFile(settings.RegistryConfig),
+	}
+	if h.Auth == nil {
+		return registry.NewClient(opts...)
+	}
+
+	username, password, err := h.Auth.Credentials()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get credentials for %s", h.Url)
+	}
+	if username != "" {
+		opts = append(opts, registry.ClientOptBasicAuth(username, password))
+	}
+
+	if h.Auth.CAFile != "" || h.Auth.InsecureSkipTLSVerify {
+		tlsConf, err := clientTLS(h.Auth.CAFile, h.Auth.InsecureSkipTLSVerify)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, registry.ClientOptHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConf,
+				Proxy:           http.ProxyFromEnvironment,
+			},
+		}))
+	}
+
+	return registry.NewClient(opts...)
+}
+
+// clientTLS returns a TLS config that trusts the CA bundle in caFile, on top of the system CAs
+func clientTLS(caFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConf := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caFile == "" {
+		return tlsConf, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read CA file")
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificates found in CA file %s", caFile)
 	}
+	tlsConf.RootCAs = pool
 
+	return tlsConf, nil
 }
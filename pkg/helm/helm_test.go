@@ -16,14 +16,52 @@ limitations under the License.
 package helm
 
 import (
+	"bytes"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/christianh814/bekind/pkg/config"
+	"golang.org/x/crypto/openpgp" //nolint:staticcheck // helm signs charts with it
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
 )
 
+// useTempHome points Home, the shared settings and the chart cache at a temp dir, so the test
+// doesn't write to the real HOME. They're put back when the test is done.
+func useTempHome(t *testing.T) string {
+	t.Helper()
+
+	home, s, cache, repos, offline := Home, settings, ChartCache, updatedRepos, Offline
+	t.Cleanup(func() {
+		Home, settings, ChartCache, updatedRepos, Offline = home, s, cache, repos, offline
+	})
+
+	dir := t.TempDir()
+	Home = dir
+	settings = newSettings()
+	ChartCache = filepath.Join(dir, "charts")
+	updatedRepos = make(map[string]bool)
+
+	return dir
+}
+
 func TestInstallFunction(t *testing.T) {
 	// Test the Install function exists and has the right signature
 	// We can't test actual execution without a Kubernetes cluster and Helm setup
@@ -36,8 +74,10 @@ func TestInstallFunction(t *testing.T) {
 		}
 	}()
 
+	useTempHome(t)
+
 	// Test with empty parameters (should fail gracefully)
-	err := Install("", "", "", "", "", "", false, nil)
+	_, err := Install(config.HelmChart{})
 	if err == nil {
 		t.Error("Install with empty parameters should return an error")
 	}
@@ -47,9 +87,6 @@ func TestRepoAddFunction(t *testing.T) {
 	// Test RepoAdd function with invalid parameters
 	// This should fail gracefully without panicking
 
-	// Create a temporary directory for testing
-	tmpDir := t.TempDir()
-
 	// Set HELM_REPOSITORY_CONFIG to our test directory
 	originalHelmConfig := os.Getenv("HELM_REPOSITORY_CONFIG")
 	defer func() {
@@ -61,8 +98,7 @@ func TestRepoAddFunction(t *testing.T) {
 	}()
 
 	// Initialize settings for testing
-	settings = cli.New()
-	settings.RepositoryConfig = filepath.Join(tmpDir, "repositories.yaml")
+	useTempHome(t)
 
 	// Test with invalid URL
 	err := RepoAdd("test-repo", "invalid-url")
@@ -81,12 +117,8 @@ func TestRepoUpdateFunction(t *testing.T) {
 	// Test RepoUpdate function
 	// This will likely fail in a test environment, but should not panic
 
-	// Create a temporary directory for testing
-	tmpDir := t.TempDir()
-
 	// Initialize settings for testing
-	settings = cli.New()
-	settings.RepositoryConfig = filepath.Join(tmpDir, "repositories.yaml")
+	useTempHome(t)
 
 	// Create an empty repositories file
 	emptyRepoFile := `apiVersion: ""
@@ -105,6 +137,189 @@ repositories: []
 	}
 }
 
+func TestRepoAddAndUpdate(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	newRepo := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[name]++
+			mu.Unlock()
+			w.Write([]byte("apiVersion: v1\nentries: {}\n"))
+		}))
+	}
+	a, b := newRepo("a"), newRepo("b")
+	defer a.Close()
+	defer b.Close()
+
+	dir := useTempHome(t)
+
+	for name, url := range map[string]string{"a": a.URL, "b": b.URL} {
+		if err := RepoAdd(name, url); err != nil {
+			t.Fatalf("RepoAdd(%s) returned error: %v", name, err)
+		}
+		// The index goes in our cache, not the user's
+		if _, err := os.Stat(filepath.Join(dir, "repository", name+"-index.yaml")); err != nil {
+			t.Errorf("Expected index for %s in the repository cache: %v", name, err)
+		}
+	}
+
+	// Only the named repo is updated
+	if err := RepoUpdate("a"); err != nil {
+		t.Fatalf("RepoUpdate returned error: %v", err)
+	}
+	if requests["a"] != 2 || requests["b"] != 1 {
+		t.Errorf("Expected only repo a to be updated, got requests %v", requests)
+	}
+
+	// Adding a repo with the same name and URL is a no-op, another URL replaces it
+	if err := RepoAdd("a", a.URL); err != nil || requests["a"] != 2 {
+		t.Errorf("Expected repo a to be left alone, got requests %v (%v)", requests, err)
+	}
+	if err := RepoAdd("a", b.URL); err != nil {
+		t.Fatalf("RepoAdd returned error: %v", err)
+	}
+	f, err := repo.LoadFile(settings.RepositoryConfig)
+	if err != nil {
+		t.Fatalf("Failed to load repositories file: %v", err)
+	}
+	if e := f.Get("a"); e == nil || e.URL != b.URL {
+		t.Errorf("Expected repo a to point to %s, got %+v", b.URL, e)
+	}
+}
+
+func TestRepoAuth(t *testing.T) {
+	// Serve a packaged chart from a repo that needs credentials
+	repoDir := t.TempDir()
+	ch, err := loader.Load(writeTestChart(t, t.TempDir()))
+	if err != nil {
+		t.Fatalf("Failed to load test chart: %v", err)
+	}
+	if _, err := chartutil.Save(ch, repoDir); err != nil {
+		t.Fatalf("Failed to package test chart: %v", err)
+	}
+	files := http.FileServer(http.Dir(repoDir))
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "dev" || p != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	index, err := repo.IndexDirectory(repoDir, srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to index repo: %v", err)
+	}
+	if err := index.WriteFile(filepath.Join(repoDir, "index.yaml"), 0644); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+
+	dir := useTempHome(t)
+
+	// Trust the test server with a CA file
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+	t.Setenv("TEST_REPO_USERNAME", "dev")
+
+	h := config.HelmChart{
+		Url:       srv.URL,
+		Repo:      "private",
+		Chart:     "myapp",
+		Release:   "myapp",
+		Namespace: "dev",
+		Auth:      &config.HelmAuth{UsernameEnv: "TEST_REPO_USERNAME", PasswordFile: passwordFile, CAFile: caFile},
+	}
+	entry, err := repoEntry(h)
+	if err != nil {
+		t.Fatalf("repoEntry returned error: %v", err)
+	}
+	if entry.Username != "dev" || entry.Password != "s3cret" || entry.CAFile != caFile {
+		t.Errorf("Unexpected repo entry: %+v", entry)
+	}
+
+	// The index and the chart are both downloaded with the credentials
+	info, err := Resolve(h)
+	if err != nil {
+		t.Fatalf("Expected the chart to be resolved with credentials, got: %v", err)
+	}
+	if info.Name != "myapp" || info.Version != "0.1.0" {
+		t.Errorf("Unexpected chart info: %+v", info)
+	}
+
+	// Only the URL and TLS settings are saved in the repo file
+	f, err := repo.LoadFile(settings.RepositoryConfig)
+	if err != nil {
+		t.Fatalf("Failed to load repo file: %v", err)
+	}
+	if e := f.Get("private"); e == nil || e.URL != srv.URL || e.CAFile != caFile || e.Username != "" || e.Password != "" {
+		t.Errorf("Expected the repo to be saved without credentials, got: %+v", e)
+	}
+	data, err := os.ReadFile(settings.RepositoryConfig)
+	if err != nil || strings.Contains(string(data), "s3cret") {
+		t.Errorf("Expected no password in the repo file, got:\n%s (%v)", data, err)
+	}
+
+	// Without credentials the repo can't be reached
+	if err := addRepo(&repo.Entry{Name: "anonymous", URL: srv.URL, CAFile: caFile}); err == nil {
+		t.Error("Expected an error without credentials")
+	}
+
+	// Missing environment variables are an error
+	h.Auth.UsernameEnv = "TEST_REPO_MISSING"
+	if _, err := repoEntry(h); err == nil {
+		t.Error("Expected an error for a missing environment variable")
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	tlsConf, err := clientTLS("", true)
+	if err != nil || !tlsConf.InsecureSkipVerify || tlsConf.RootCAs != nil {
+		t.Errorf("Expected insecure TLS config with system CAs, got %+v (%v)", tlsConf, err)
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	if _, err := clientTLS(notPEM, false); err == nil {
+		t.Error("Expected an error for a CA file without certificates")
+	}
+	if _, err := clientTLS(filepath.Join(t.TempDir(), "missing.pem"), false); err == nil {
+		t.Error("Expected an error for a missing CA file")
+	}
+}
+
+func TestNewSettings(t *testing.T) {
+	s := newSettings()
+	if s.RepositoryConfig != filepath.Join(Home, "repositories.yaml") || s.RepositoryCache != filepath.Join(Home, "repository") {
+		t.Errorf("Expected repository config and cache under %s, got %s and %s", Home, s.RepositoryConfig, s.RepositoryCache)
+	}
+	if !strings.HasSuffix(Home, filepath.Join(".bekind", "helm")) {
+		t.Errorf("Expected Home to be under .bekind, got %s", Home)
+	}
+
+	// Each chart gets the shared repo settings with its own namespace
+	cs := chartSettings("dev")
+	if cs.Namespace() != "dev" || cs.RepositoryConfig != settings.RepositoryConfig || cs.RepositoryCache != settings.RepositoryCache {
+		t.Errorf("Unexpected chart settings: namespace %s, config %s, cache %s", cs.Namespace(), cs.RepositoryConfig, cs.RepositoryCache)
+	}
+
+	// Charts go into the KIND cluster's context when it's set
+	KubeContext = "kind-dev"
+	t.Cleanup(func() { KubeContext = "" })
+	if cs := chartSettings("dev"); cs.KubeContext != "kind-dev" {
+		t.Errorf("Expected kube context kind-dev, got %q", cs.KubeContext)
+	}
+}
+
 func TestInstallChartFunction(t *testing.T) {
 	// Test InstallChart function exists and handles invalid parameters
 
@@ -114,8 +329,10 @@ func TestInstallChartFunction(t *testing.T) {
 		}
 	}()
 
+	useTempHome(t)
+
 	// Test with invalid parameters
-	err := InstallChart("", "", "", "", "", false, nil)
+	_, err := InstallChart(config.HelmChart{})
 	if err == nil {
 		t.Error("InstallChart with empty parameters should return an error")
 	}
@@ -303,3 +520,757 @@ func TestHelmDriverEnvironment(t *testing.T) {
 		os.Setenv("HELM_DRIVER", originalDriver)
 	}
 }
+
+func TestChangedValues(t *testing.T) {
+	// Stored values come back from JSON, so numbers are float64
+	previous := map[string]interface{}{
+		"replicas": float64(1),
+		"controller": map[string]interface{}{
+			"hostNetwork": true,
+			"extraArgs": map[string]interface{}{
+				"enableSSLPassthrough": true,
+			},
+		},
+		"removed": "yes",
+	}
+
+	// Values from the config come from yaml, so numbers are int
+	current := map[string]interface{}{
+		"replicas": 1,
+		"controller": map[string]interface{}{
+			"hostNetwork": false,
+			"extraArgs": map[string]interface{}{
+				"enableSSLPassthrough": true,
+			},
+		},
+		"added": []interface{}{"a"},
+	}
+
+	changed, err := changedValues(previous, current)
+	if err != nil {
+		t.Fatalf("changedValues() returned error: %v", err)
+	}
+
+	expected := []string{"added", "controller.hostNetwork", "removed"}
+	if strings.Join(changed, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected changed values %v, got %v", expected, changed)
+	}
+
+	changed, err = changedValues(previous, previous)
+	if err != nil {
+		t.Fatalf("changedValues() returned error: %v", err)
+	}
+	if len(changed) != 0 {
+		t.Errorf("Expected no changed values, got %v", changed)
+	}
+
+	// No values at all is the same as empty values
+	changed, err = changedValues(nil, map[string]interface{}{})
+	if err != nil || len(changed) != 0 {
+		t.Errorf("Expected no changed values for nil and empty values, got %v (%v)", changed, err)
+	}
+}
+
+func TestResultString(t *testing.T) {
+	testCases := []struct {
+		result   Result
+		expected string
+	}{
+		{
+			Result{Release: "argocd", Namespace: "argocd", Action: ActionInstalled, Chart: "argo-cd", Version: "9.1.0"},
+			"argocd/argocd: installed argo-cd 9.1.0",
+		},
+		{
+			Result{Release: "argocd", Namespace: "argocd", Action: ActionUnchanged, Chart: "argo-cd", Version: "9.1.0", PreviousVersion: "9.1.0"},
+			"argocd/argocd: unchanged argo-cd 9.1.0",
+		},
+		{
+			Result{Release: "argocd", Namespace: "argocd", Action: ActionUpgraded, Chart: "argo-cd", Version: "9.1.0", PreviousVersion: "9.0.0"},
+			"argocd/argocd: upgraded argo-cd 9.0.0 -> 9.1.0",
+		},
+		{
+			Result{Release: "argocd", Namespace: "argocd", Action: ActionUpgraded, Chart: "argo-cd", Version: "9.1.0", PreviousVersion: "9.1.0", ChangedValues: []string{"configs.cm", "server.replicas"}},
+			"argocd/argocd: upgraded argo-cd 9.1.0, values changed: configs.cm, server.replicas",
+		},
+		{
+			Result{Release: "myapp", Namespace: "dev", Action: ActionUpgraded, Chart: "myapp", Version: "0.1.0", PreviousVersion: "0.1.0", TemplatesChanged: true},
+			"dev/myapp: upgraded myapp 0.1.0, templates changed",
+		},
+		{
+			Result{Release: "myapp", Namespace: "dev", Action: ActionUpgraded, Chart: "myapp", Version: "0.1.0", PreviousVersion: "0.1.0", ManifestsChanged: true},
+			"dev/myapp: upgraded myapp 0.1.0, manifests changed",
+		},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.result.String(); got != tc.expected {
+			t.Errorf("Expected '%s', got '%s'", tc.expected, got)
+		}
+	}
+}
+
+// writeTestChart writes a chart with a single template to dir and returns its path
+func writeTestChart(t *testing.T, dir string) string {
+	path := filepath.Join(dir, "myapp")
+	files := map[string]string{
+		"Chart.yaml":               "apiVersion: v2\nname: myapp\nversion: 0.1.0\nappVersion: \"1.0\"\n",
+		"values.yaml":              "replicas: 1\n",
+		"templates/configmap.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: myapp\n",
+	}
+	for name, data := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(path, name)), 0755); err != nil {
+			t.Fatalf("Failed to create chart dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(path, name), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write chart file: %v", err)
+		}
+	}
+
+	return path
+}
+
+func TestResolveLocalChart(t *testing.T) {
+	dir := t.TempDir()
+	chartDir := writeTestChart(t, dir)
+
+	// Package the chart too, both should resolve the same way
+	ch, err := loader.Load(chartDir)
+	if err != nil {
+		t.Fatalf("Failed to load test chart: %v", err)
+	}
+	tgz, err := chartutil.Save(ch, dir)
+	if err != nil {
+		t.Fatalf("Failed to package test chart: %v", err)
+	}
+
+	for _, path := range []string{chartDir, tgz} {
+		info, err := Resolve(config.HelmChart{Path: path, Release: "myapp", Namespace: "dev", Set: []string{"replicas=2"}})
+		if err != nil {
+			t.Fatalf("Unexpected error resolving %s: %v", path, err)
+		}
+		if info.Name != "myapp" || info.Version != "0.1.0" || info.AppVersion != "1.0" {
+			t.Errorf("Unexpected chart info for %s: %+v", path, info)
+		}
+		if info.Values["replicas"] != int64(2) {
+			t.Errorf("Expected replicas to be set to 2, got %v", info.Values["replicas"])
+		}
+	}
+
+	if _, err := Resolve(config.HelmChart{Path: filepath.Join(dir, "missing"), Release: "myapp", Namespace: "dev"}); err == nil {
+		t.Error("Expected an error for a missing chart path")
+	}
+}
+
+// signTestChart packages the chart in chartDir and signs it with a new key. It returns the
+// path of the packaged chart and of the keyring with the key.
+func signTestChart(t *testing.T, chartDir string) (string, string) {
+	dir := t.TempDir()
+	entity, err := openpgp.NewEntity("bekind test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	keyring := filepath.Join(dir, "pubring.gpg")
+	f, err := os.Create(keyring)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	if err := entity.SerializePrivate(f, nil); err != nil {
+		t.Fatalf("Failed to write keyring: %v", err)
+	}
+	f.Close()
+
+	ch, err := loader.Load(chartDir)
+	if err != nil {
+		t.Fatalf("Failed to load test chart: %v", err)
+	}
+	tgz, err := chartutil.Save(ch, dir)
+	if err != nil {
+		t.Fatalf("Failed to package test chart: %v", err)
+	}
+
+	signer, err := provenance.NewFromKeyring(keyring, "bekind test")
+	if err != nil {
+		t.Fatalf("Failed to load signing key: %v", err)
+	}
+	sig, err := signer.ClearSign(tgz)
+	if err != nil {
+		t.Fatalf("Failed to sign test chart: %v", err)
+	}
+	if err := os.WriteFile(tgz+".prov", []byte(sig), 0644); err != nil {
+		t.Fatalf("Failed to write provenance file: %v", err)
+	}
+
+	return tgz, keyring
+}
+
+func TestVerifyLocalChart(t *testing.T) {
+	chartDir := writeTestChart(t, t.TempDir())
+	tgz, keyring := signTestChart(t, chartDir)
+
+	h := config.HelmChart{Path: tgz, Release: "myapp", Namespace: "dev", Verify: true, Keyring: keyring}
+	if _, err := Resolve(h); err != nil {
+		t.Errorf("Expected the signed chart to verify, got: %v", err)
+	}
+
+	// A chart signed with another key doesn't verify
+	_, otherKeyring := signTestChart(t, chartDir)
+	h.Keyring = otherKeyring
+	if _, err := Resolve(h); err == nil {
+		t.Error("Expected an error for a chart signed with another key")
+	}
+
+	// Without a provenance file there's nothing to verify against
+	h.Keyring = keyring
+	if err := os.Remove(tgz + ".prov"); err != nil {
+		t.Fatalf("Failed to remove provenance file: %v", err)
+	}
+	if _, err := Resolve(h); err == nil {
+		t.Error("Expected an error for a chart without a provenance file")
+	}
+
+	// Directories can't be signed
+	h.Path = chartDir
+	if _, err := Resolve(h); err == nil {
+		t.Error("Expected an error verifying a chart directory")
+	}
+}
+
+func TestOCIRef(t *testing.T) {
+	h := config.HelmChart{Url: "oci://registry.example.com/charts/app"}
+	if ref := ociRef(h); ref != h.Url {
+		t.Errorf("Expected %s, got %s", h.Url, ref)
+	}
+
+	h.Digest = "sha256:" + strings.Repeat("ab", 32)
+	if ref := ociRef(h); ref != h.Url+"@"+h.Digest {
+		t.Errorf("Expected the digest to be in the reference, got %s", ref)
+	}
+}
+
+func TestTemplatesChanged(t *testing.T) {
+	chartDir := writeTestChart(t, t.TempDir())
+	a, err := loader.Load(chartDir)
+	if err != nil {
+		t.Fatalf("Failed to load test chart: %v", err)
+	}
+	b, err := loader.Load(chartDir)
+	if err != nil {
+		t.Fatalf("Failed to load test chart: %v", err)
+	}
+
+	if templatesChanged(a, b) {
+		t.Error("Expected the same chart to have the same templates")
+	}
+
+	b.Templates[0].Data = []byte("apiVersion: v1\nkind: Secret\n")
+	if !templatesChanged(a, b) {
+		t.Error("Expected changed templates to be detected")
+	}
+
+	if !templatesChanged(nil, b) {
+		t.Error("Expected a missing chart to be changed")
+	}
+}
+
+const testManifests = `---
+# Source: myapp/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+spec:
+  replicas: 1
+---
+# Source: myapp/templates/job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: myapp:1.0
+`
+
+func TestPatchRenderer(t *testing.T) {
+	patchFile := filepath.Join(t.TempDir(), "tolerations.yaml")
+	patch := "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\nspec:\n  template:\n    spec:\n      tolerations:\n      - operator: Exists\n"
+	if err := os.WriteFile(patchFile, []byte(patch), 0644); err != nil {
+		t.Fatalf("Failed to write patch: %v", err)
+	}
+
+	pr, err := postRenderer(config.HelmChart{PostRenderer: &config.PostRenderer{
+		Patches: []config.PostRenderPatch{
+			{Path: patchFile},
+			{
+				Patch:  "- op: replace\n  path: /spec/replicas\n  value: 3\n",
+				Target: &config.PatchTarget{Kind: "Deployment", Name: "myapp"},
+			},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	out, err := pr.Run(bytes.NewBufferString(testManifests))
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	for _, want := range []string{"replicas: 3", "tolerations:\n      - operator: Exists", "image: myapp:1.0"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected patched manifests to contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	// Nothing rendered, nothing to patch
+	if out, err := pr.Run(bytes.NewBufferString("\n")); err != nil || out.String() != "\n" {
+		t.Errorf("Expected empty manifests to be left alone, got %q (%v)", out.String(), err)
+	}
+
+	// Patches that don't apply are an error
+	bad, _ := postRenderer(config.HelmChart{PostRenderer: &config.PostRenderer{
+		Patches: []config.PostRenderPatch{{Patch: "- op: remove\n  path: /spec/nope\n", Target: &config.PatchTarget{Kind: "Deployment"}}},
+	}})
+	if _, err := bad.Run(bytes.NewBufferString(testManifests)); err == nil {
+		t.Error("Expected an error for a patch that doesn't apply")
+	}
+}
+
+func TestPostRenderer(t *testing.T) {
+	if pr, err := postRenderer(config.HelmChart{}); pr != nil || err != nil {
+		t.Errorf("Expected no post renderer, got %v (%v)", pr, err)
+	}
+
+	if _, err := postRenderer(config.HelmChart{PostRenderer: &config.PostRenderer{Exec: "/nonexistent/renderer"}}); err == nil {
+		t.Error("Expected an error for a missing exec binary")
+	}
+
+	// Patches and exec are chained, cat passes the patched manifests through
+	pr, err := postRenderer(config.HelmChart{PostRenderer: &config.PostRenderer{
+		Patches: []config.PostRenderPatch{{
+			Patch:  "- op: replace\n  path: /spec/replicas\n  value: 2\n",
+			Target: &config.PatchTarget{Kind: "Deployment"},
+		}},
+		Exec: "cat",
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := pr.(chainRenderer); !ok {
+		t.Fatalf("Expected a chain of post renderers, got %T", pr)
+	}
+	out, err := pr.Run(bytes.NewBufferString(testManifests))
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "replicas: 2") {
+		t.Errorf("Expected patched manifests, got:\n%s", out.String())
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	override := filepath.Join(dir, "override.yaml")
+	if err := os.WriteFile(base, []byte("controller:\n  replicas: 1\n  image:\n    tag: v1\n  service:\n    type: ClusterIP\nfromBase: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to write values file: %v", err)
+	}
+	if err := os.WriteFile(override, []byte("controller:\n  image:\n    tag: v2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write values file: %v", err)
+	}
+
+	h := config.HelmChart{
+		ValuesFiles: []string{base, override},
+		ValuesObject: map[string]interface{}{
+			"controller": map[string]interface{}{
+				"replicas": 2,
+				"service":  map[string]interface{}{"type": "NodePort"},
+			},
+		},
+		Set:       []string{"controller.service.type=LoadBalancer", "controller.replicas=3"},
+		SetString: []string{"controller.image.tag=1234"},
+	}
+
+	vals, err := mergeValues(h, nil)
+	if err != nil {
+		t.Fatalf("mergeValues() returned error: %v", err)
+	}
+
+	controller := vals["controller"].(map[string]interface{})
+	if controller["replicas"] != int64(3) {
+		t.Errorf("Expected set to win for replicas, got %v (%T)", controller["replicas"], controller["replicas"])
+	}
+	if controller["service"].(map[string]interface{})["type"] != "LoadBalancer" {
+		t.Errorf("Expected set to win for service type, got %v", controller["service"])
+	}
+	if controller["image"].(map[string]interface{})["tag"] != "1234" {
+		t.Errorf("Expected setString to win for image tag, got %v", controller["image"])
+	}
+	if vals["fromBase"] != true {
+		t.Errorf("Expected values from the first file to be kept, got %v", vals["fromBase"])
+	}
+
+	// The config's valuesObject shouldn't be changed by set
+	service := h.ValuesObject["controller"].(map[string]interface{})["service"].(map[string]interface{})
+	if service["type"] != "NodePort" {
+		t.Errorf("Expected valuesObject to be unchanged, got %v", service["type"])
+	}
+
+	// Later values files win over earlier ones, and valuesObject wins over files
+	h.Set = nil
+	h.SetString = nil
+	vals, err = mergeValues(h, nil)
+	if err != nil {
+		t.Fatalf("mergeValues() returned error: %v", err)
+	}
+	controller = vals["controller"].(map[string]interface{})
+	if controller["image"].(map[string]interface{})["tag"] != "v2" {
+		t.Errorf("Expected later values file to win, got %v", controller["image"])
+	}
+	if controller["replicas"] != 2 {
+		t.Errorf("Expected valuesObject to win over values files, got %v", controller["replicas"])
+	}
+
+	// Bad set data and missing files are errors
+	if _, err := mergeValues(config.HelmChart{Set: []string{"a.b[=1"}}, nil); err == nil {
+		t.Error("Expected an error for bad set data")
+	}
+	if _, err := mergeValues(config.HelmChart{ValuesFiles: []string{filepath.Join(dir, "missing.yaml")}}, nil); err == nil {
+		t.Error("Expected an error for a missing values file")
+	}
+}
+
+func TestRender(t *testing.T) {
+	chartDir := writeTestChart(t, t.TempDir())
+	tmpl := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: {{ .Release.Name }}\n  namespace: {{ .Release.Namespace }}\nspec:\n  replicas: {{ .Values.replicas }}\n"
+	if err := os.WriteFile(filepath.Join(chartDir, "templates", "deployment.yaml"), []byte(tmpl), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	// Rendering doesn't need a cluster
+	manifest, err := render(config.HelmChart{Path: chartDir, Release: "web", Namespace: "dev", Set: []string{"replicas=3"}}, chartSettings("dev"), nil)
+	if err != nil {
+		t.Fatalf("render() returned error: %v", err)
+	}
+	for _, want := range []string{"name: web", "namespace: dev", "replicas: 3", "kind: ConfigMap"} {
+		if !strings.Contains(manifest, want) {
+			t.Errorf("Expected rendered manifest to contain %q, got:\n%s", want, manifest)
+		}
+	}
+
+	// The post renderer is applied to the rendered manifest
+	h := config.HelmChart{Path: chartDir, Release: "web", Namespace: "dev", PostRenderer: &config.PostRenderer{
+		Patches: []config.PostRenderPatch{{
+			Patch:  "- op: replace\n  path: /spec/replicas\n  value: 5\n",
+			Target: &config.PatchTarget{Kind: "Deployment"},
+		}},
+	}}
+	manifest, err = render(h, chartSettings("dev"), nil)
+	if err != nil {
+		t.Fatalf("render() returned error: %v", err)
+	}
+	if !strings.Contains(manifest, "replicas: 5") {
+		t.Errorf("Expected the patch to be applied, got:\n%s", manifest)
+	}
+}
+
+func TestRenderCapabilities(t *testing.T) {
+	chartDir := writeTestChart(t, t.TempDir())
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("apiVersion: v2\nname: myapp\nversion: 0.1.0\nkubeVersion: \">=1.25.0-0\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Chart.yaml: %v", err)
+	}
+	tmpl := "{{ if .Capabilities.APIVersions.Has \"gateway.networking.k8s.io/v1\" }}apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: gateway\n  annotations:\n    kube: {{ .Capabilities.KubeVersion.Version }}\n{{ end }}"
+	if err := os.WriteFile(filepath.Join(chartDir, "templates", "gateway.yaml"), []byte(tmpl), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	h := config.HelmChart{Path: chartDir, Release: "web", Namespace: "dev"}
+
+	// Helm's default Kubernetes version is too old for the chart
+	if _, err := render(h, chartSettings("dev"), nil); err == nil {
+		t.Error("Expected the kubeVersion constraint to fail with helm's default capabilities")
+	}
+
+	kv, err := chartutil.ParseKubeVersion("v1.34.0")
+	if err != nil {
+		t.Fatalf("ParseKubeVersion() returned error: %v", err)
+	}
+	caps := &chartutil.Capabilities{KubeVersion: *kv, APIVersions: chartutil.VersionSet{"gateway.networking.k8s.io/v1"}}
+	manifest, err := render(h, chartSettings("dev"), caps)
+	if err != nil {
+		t.Fatalf("render() returned error: %v", err)
+	}
+	for _, want := range []string{"name: gateway", "kube: v1.34.0"} {
+		if !strings.Contains(manifest, want) {
+			t.Errorf("Expected rendered manifest to contain %q, got:\n%s", want, manifest)
+		}
+	}
+}
+
+func TestDiffManifests(t *testing.T) {
+	live := `---
+# Source: myapp/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myapp
+data:
+  color: blue
+---
+# Source: myapp/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: myapp
+---
+# Source: myapp/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: myapp
+  namespace: dev
+`
+	rendered := `---
+# Source: myapp/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myapp
+data:
+  color: green
+---
+# Source: myapp/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: myapp
+  namespace: dev
+---
+# Source: myapp/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+  namespace: dev
+`
+
+	diffs, err := diffManifests(live, rendered)
+	if err != nil {
+		t.Fatalf("diffManifests() returned error: %v", err)
+	}
+
+	// The unchanged service is left out, the rest are sorted
+	want := []struct{ object, change string }{
+		{"ConfigMap/myapp", ChangeChanged},
+		{"Deployment/dev/myapp", ChangeAdded},
+		{"Secret/myapp", ChangeRemoved},
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("Expected %d diffs, got %+v", len(want), diffs)
+	}
+	for i, w := range want {
+		if diffs[i].String() != w.object || diffs[i].Change != w.change {
+			t.Errorf("Expected %s %s, got %s %s", w.change, w.object, diffs[i].Change, diffs[i].String())
+		}
+	}
+	if !strings.Contains(diffs[0].Diff, "-  color: blue\n") || !strings.Contains(diffs[0].Diff, "+  color: green\n") {
+		t.Errorf("Unexpected diff for the ConfigMap:\n%s", diffs[0].Diff)
+	}
+	if !strings.Contains(diffs[1].Diff, "+kind: Deployment\n") {
+		t.Errorf("Unexpected diff for the Deployment:\n%s", diffs[1].Diff)
+	}
+
+	// Nothing to diff when the manifests are the same
+	diffs, err = diffManifests(live, live)
+	if err != nil {
+		t.Fatalf("diffManifests() returned error: %v", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("Expected no diffs, got %+v", diffs)
+	}
+}
+
+func TestResolveSameChartTogether(t *testing.T) {
+	// Serve a packaged chart from a repo, keeping track of how many downloads overlap
+	repoDir := t.TempDir()
+	ch, err := loader.Load(writeTestChart(t, t.TempDir()))
+	if err != nil {
+		t.Fatalf("Failed to load test chart: %v", err)
+	}
+	if _, err := chartutil.Save(ch, repoDir); err != nil {
+		t.Fatalf("Failed to package test chart: %v", err)
+	}
+	var mu sync.Mutex
+	downloading, overlapped := 0, false
+	files := http.FileServer(http.Dir(repoDir))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			mu.Lock()
+			downloading++
+			overlapped = overlapped || downloading > 1
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				downloading--
+				mu.Unlock()
+			}()
+			time.Sleep(100 * time.Millisecond)
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	index, err := repo.IndexDirectory(repoDir, srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to index repo: %v", err)
+	}
+	if err := index.WriteFile(filepath.Join(repoDir, "index.yaml"), 0644); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+
+	useTempHome(t)
+
+	// Two releases of the same chart, like installCharts runs them
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, release := range []string{"first", "second"} {
+		wg.Add(1)
+		go func(i int, release string) {
+			defer wg.Done()
+			_, errs[i] = Resolve(config.HelmChart{Url: srv.URL, Repo: "shared", Chart: "myapp", Release: release, Namespace: release, Version: "0.1.0"})
+		}(i, release)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Resolve() of release %d returned error: %v", i, err)
+		}
+	}
+	if overlapped {
+		t.Error("Expected releases of the same chart to download it one at a time")
+	}
+}
+
+func TestPrefetchAndOffline(t *testing.T) {
+	// Serve a packaged chart from a repo
+	repoDir := t.TempDir()
+	ch, err := loader.Load(writeTestChart(t, t.TempDir()))
+	if err != nil {
+		t.Fatalf("Failed to load test chart: %v", err)
+	}
+	if _, err := chartutil.Save(ch, repoDir); err != nil {
+		t.Fatalf("Failed to package test chart: %v", err)
+	}
+	srv := httptest.NewServer(http.FileServer(http.Dir(repoDir)))
+	index, err := repo.IndexDirectory(repoDir, srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to index repo: %v", err)
+	}
+	if err := index.WriteFile(filepath.Join(repoDir, "index.yaml"), 0644); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+
+	dir := useTempHome(t)
+
+	h := config.HelmChart{Url: srv.URL, Repo: "prefetch", Chart: "myapp", Release: "myapp", Namespace: "dev", Version: "0.1.0"}
+	cached, err := Prefetch(h)
+	if err != nil {
+		t.Fatalf("Prefetch() returned error: %v", err)
+	}
+	if cached.Name != "myapp" || cached.ChartVersion != "0.1.0" || !strings.HasPrefix(cached.Digest, "sha256:") {
+		t.Errorf("Unexpected cached chart: %+v", cached)
+	}
+	if digest, err := fileDigest(filepath.Join(ChartCache, cached.File)); err != nil || digest != cached.Digest {
+		t.Errorf("Expected cached file with digest %s, got %s (%v)", cached.Digest, digest, err)
+	}
+
+	// Prefetching again replaces the entry instead of adding another
+	if _, err := Prefetch(h); err != nil {
+		t.Fatalf("Prefetch() returned error: %v", err)
+	}
+	idx, err := loadIndex()
+	if err != nil || len(idx.Charts) != 1 {
+		t.Errorf("Expected 1 chart in the index, got %+v (%v)", idx, err)
+	}
+
+	// Offline, the chart comes from the cache without the repo
+	srv.Close()
+	updatedRepos = make(map[string]bool)
+	Offline = true
+	info, err := Resolve(h)
+	if err != nil {
+		t.Fatalf("Resolve() offline returned error: %v", err)
+	}
+	if info.Name != "myapp" || info.Version != "0.1.0" {
+		t.Errorf("Unexpected chart info: %+v", info)
+	}
+
+	// Versions that weren't prefetched aren't found
+	h.Version = "0.2.0"
+	if _, err := Resolve(h); err == nil || !strings.Contains(err.Error(), "bekind prefetch") {
+		t.Errorf("Expected an error for a chart that isn't cached, got %v", err)
+	}
+
+	// A cached chart that changed is refused
+	h.Version = "0.1.0"
+	if err := os.WriteFile(filepath.Join(ChartCache, cached.File), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to change cached chart: %v", err)
+	}
+	if _, err := Resolve(h); err == nil || !strings.Contains(err.Error(), "expected "+cached.Digest) {
+		t.Errorf("Expected a digest mismatch error, got %v", err)
+	}
+
+	// Local charts aren't prefetched
+	if _, err := Prefetch(config.HelmChart{Path: dir}); err == nil {
+		t.Error("Expected an error prefetching a local chart")
+	}
+}
+
+func TestListAndUninstall(t *testing.T) {
+	mem := driver.NewMemory()
+	mem.SetNamespace("dev")
+	actionConfig := &action.Configuration{
+		Releases:     storage.Init(mem),
+		KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          debug,
+	}
+	rel := &release.Release{
+		Name:      "web",
+		Namespace: "dev",
+		Version:   2,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "myapp", Version: "0.1.0", AppVersion: "1.0"}},
+	}
+	if err := actionConfig.Releases.Create(rel); err != nil {
+		t.Fatalf("Failed to create release: %v", err)
+	}
+
+	releases, err := listReleases(actionConfig)
+	if err != nil {
+		t.Fatalf("listReleases() returned error: %v", err)
+	}
+	if len(releases) != 1 {
+		t.Fatalf("Expected 1 release, got %+v", releases)
+	}
+	want := ReleaseStatus{Release: "web", Namespace: "dev", Chart: "myapp", Version: "0.1.0", AppVersion: "1.0", Status: "deployed", Revision: 2}
+	if releases[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, releases[0])
+	}
+
+	h := config.HelmChart{Release: "web", Namespace: "dev"}
+	uninstalled, err := uninstall(actionConfig, h)
+	if err != nil || !uninstalled {
+		t.Fatalf("Expected release to be uninstalled, got %v (%v)", uninstalled, err)
+	}
+	if releases, err := listReleases(actionConfig); err != nil || len(releases) != 0 {
+		t.Errorf("Expected no releases after uninstalling, got %+v (%v)", releases, err)
+	}
+
+	// Uninstalling a release that isn't there isn't an error
+	uninstalled, err = uninstall(actionConfig, h)
+	if err != nil || uninstalled {
+		t.Errorf("Expected nothing to uninstall, got %v (%v)", uninstalled, err)
+	}
+}
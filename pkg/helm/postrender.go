@@ -0,0 +1,107 @@
+package helm
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/christianh814/bekind/pkg/config"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/postrender"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// postRenderer returns the post renderer for the chart, or nil if it doesn't have one
+func postRenderer(h config.HelmChart) (postrender.PostRenderer, error) {
+	pr := h.PostRenderer
+	if pr == nil {
+		return nil, nil
+	}
+
+	var renderers chainRenderer
+	if len(pr.Patches) != 0 {
+		renderers = append(renderers, &patchRenderer{patches: pr.Patches})
+	}
+	if pr.Exec != "" {
+		e, err := postrender.NewExec(pr.Exec, pr.Args...)
+		if err != nil {
+			return nil, err
+		}
+		renderers = append(renderers, e)
+	}
+
+	if len(renderers) == 1 {
+		return renderers[0], nil
+	}
+	return renderers, nil
+}
+
+// chainRenderer runs post renderers one after the other
+type chainRenderer []postrender.PostRenderer
+
+// Run passes the manifests through each post renderer
+func (c chainRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	var err error
+	for _, r := range c {
+		if renderedManifests, err = r.Run(renderedManifests); err != nil {
+			return nil, err
+		}
+	}
+
+	return renderedManifests, nil
+}
+
+// patchRenderer applies kustomize patches to the rendered manifests
+type patchRenderer struct {
+	patches []config.PostRenderPatch
+}
+
+// Run builds a kustomization in memory with the manifests as its only resource
+func (r *patchRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	// Nothing to patch, and kustomize doesn't like empty resources
+	if len(bytes.TrimSpace(renderedManifests.Bytes())) == 0 {
+		return renderedManifests, nil
+	}
+
+	// Patches from files are put inline, the in memory filesystem only has the manifests
+	kustomization := struct {
+		Resources []string                 `yaml:"resources"`
+		Patches   []config.PostRenderPatch `yaml:"patches"`
+	}{
+		Resources: []string{"manifests.yaml"},
+	}
+	for _, p := range r.patches {
+		if p.Path != "" {
+			data, err := os.ReadFile(p.Path)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read patch")
+			}
+			p.Patch, p.Path = string(data), ""
+		}
+		kustomization.Patches = append(kustomization.Patches, p)
+	}
+	k, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return nil, err
+	}
+
+	fSys := filesys.MakeFsInMemory()
+	if err := fSys.WriteFile("/manifests.yaml", renderedManifests.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := fSys.WriteFile("/kustomization.yaml", k); err != nil {
+		return nil, err
+	}
+
+	resMap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fSys, "/")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to apply patches")
+	}
+	out, err := resMap.AsYaml()
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewBuffer(out), nil
+}
@@ -0,0 +1,103 @@
+package helm
+
+import (
+	"os"
+	"time"
+
+	"github.com/christianh814/bekind/pkg/config"
+	"helm.sh/helm/v3/pkg/action"
+)
+
+// ReleaseStatus is a release that is on the cluster
+type ReleaseStatus struct {
+	Release    string
+	Namespace  string
+	Chart      string
+	Version    string
+	AppVersion string
+	Status     string
+	Revision   int
+	Updated    time.Time
+}
+
+// ListReleases returns the releases in every namespace of the cluster in KubeContext, whatever
+// their status
+func ListReleases() ([]ReleaseStatus, error) {
+	settings := chartSettings("")
+
+	actionConfig := new(action.Configuration)
+	if err := actionConfig.Init(settings.RESTClientGetter(), "", os.Getenv("HELM_DRIVER"), debug); err != nil {
+		return nil, err
+	}
+
+	return listReleases(actionConfig)
+}
+
+// listReleases lists the releases with the given action config
+func listReleases(actionConfig *action.Configuration) ([]ReleaseStatus, error) {
+	client := action.NewList(actionConfig)
+	client.AllNamespaces = true
+	client.All = true
+	client.SetStateMask()
+
+	rels, err := client.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []ReleaseStatus
+	for _, r := range rels {
+		rs := ReleaseStatus{
+			Release:   r.Name,
+			Namespace: r.Namespace,
+			Revision:  r.Version,
+		}
+		if r.Chart != nil && r.Chart.Metadata != nil {
+			rs.Chart = r.Chart.Metadata.Name
+			rs.Version = r.Chart.Metadata.Version
+			rs.AppVersion = r.Chart.Metadata.AppVersion
+		}
+		if r.Info != nil {
+			rs.Status = r.Info.Status.String()
+			rs.Updated = r.Info.LastDeployed.Time
+		}
+		releases = append(releases, rs)
+	}
+
+	return releases, nil
+}
+
+// Uninstall removes the release of the given helm chart from the cluster. It returns false
+// if the release wasn't installed.
+func Uninstall(h config.HelmChart) (bool, error) {
+	settings := chartSettings(h.Namespace)
+
+	actionConfig := new(action.Configuration)
+	if err := actionConfig.Init(settings.RESTClientGetter(), settings.Namespace(), os.Getenv("HELM_DRIVER"), debug); err != nil {
+		return false, err
+	}
+
+	return uninstall(actionConfig, h)
+}
+
+// uninstall removes the release with the given action config
+func uninstall(actionConfig *action.Configuration, h config.HelmChart) (bool, error) {
+	timeout, err := h.TimeoutDuration()
+	if err != nil {
+		return false, err
+	}
+
+	client := action.NewUninstall(actionConfig)
+	client.Wait = h.ShouldWait()
+	client.Timeout = timeout
+	client.DisableHooks = h.DisableHooks
+	client.IgnoreNotFound = true
+
+	res, err := client.Run(h.Release)
+	if err != nil {
+		return false, err
+	}
+
+	// Nothing comes back when the release wasn't there
+	return res != nil, nil
+}
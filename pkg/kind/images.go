@@ -0,0 +1,89 @@
+package kind
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/christianh814/bekind/pkg/utils"
+)
+
+// ImageSource is the container runtime on the host that images are loaded into the cluster from
+type ImageSource interface {
+	// Name returns the name of the runtime
+	Name() string
+	// Pull pulls the image from its registry
+	Pull(image string) error
+	// Save saves the images into a tar archive at dest
+	Save(images []string, dest string) error
+	// ImageID returns the ID of the local image, as containerd on the nodes reports it
+	ImageID(image string) (string, error)
+}
+
+// Images is where images are loaded from, it matches the runtime the Provider uses
+var Images ImageSource = GetImageSource()
+
+// GetImageSource selects the image source from utils.DetectRuntime, the same
+// runtime utils.GetDefaultRuntime selects the KIND provider from
+func GetImageSource() ImageSource {
+	switch r := utils.DetectRuntime(); r {
+	case "podman":
+		return podmanImages{cliImages{binary: r}}
+	default:
+		return cliImages{binary: r}
+	}
+}
+
+// cliImages is a runtime with a docker compatible CLI, like docker and nerdctl
+type cliImages struct {
+	binary string
+}
+
+// Name returns the name of the runtime binary
+func (c cliImages) Name() string {
+	return c.binary
+}
+
+// Pull pulls the image, as in `docker pull`
+func (c cliImages) Pull(image string) error {
+	return exec.Command(c.binary, "pull", image).Run()
+}
+
+// Save saves images to dest, as in `docker save`
+func (c cliImages) Save(images []string, dest string) error {
+	commandArgs := append([]string{"save", "-o", dest}, images...)
+	return exec.Command(c.binary, commandArgs...).Run()
+}
+
+// ImageID returns the ID of the image, as in `docker image inspect`
+func (c cliImages) ImageID(image string) (string, error) {
+	out, err := exec.Command(c.binary, "image", "inspect", "-f", "{{ .Id }}", image).Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// podmanImages is podman, which mostly works like docker
+type podmanImages struct {
+	cliImages
+}
+
+// Save saves images to dest. Podman only puts more than one image in an archive when asked to.
+func (p podmanImages) Save(images []string, dest string) error {
+	commandArgs := append([]string{"save", "--multi-image-archive", "-o", dest}, images...)
+	return exec.Command(p.binary, commandArgs...).Run()
+}
+
+// ImageID returns the ID of the image. Podman leaves the digest algorithm off, containerd doesn't.
+func (p podmanImages) ImageID(image string) (string, error) {
+	id, err := p.cliImages.ImageID(image)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(id, "sha256:") {
+		id = "sha256:" + id
+	}
+
+	return id, nil
+}
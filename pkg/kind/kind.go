@@ -1,13 +1,23 @@
 package kind
 
 import (
+	"archive/tar"
 	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/christianh814/bekind/pkg/config"
 	"github.com/christianh814/bekind/pkg/utils"
-	"github.com/spf13/viper"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 	kindConfig "sigs.k8s.io/kind/pkg/apis/config/defaults"
 	"sigs.k8s.io/kind/pkg/cluster"
 	"sigs.k8s.io/kind/pkg/cluster/nodes"
@@ -19,27 +29,34 @@ type (
 	imageTagFetcher func(nodes.Node, string) (map[string]bool, error)
 )
 
+// maxParallelLoads is how many nodes images are loaded onto at the same time
+const maxParallelLoads = 4
+
 // We are using the same kind of provider for this whole package
 var Provider *cluster.Provider = cluster.NewProvider(
 	utils.GetDefaultRuntime(),
 )
 
 // CreateKindCluster creates KIND cluster
-func CreateKindCluster(name string, kindImage string) error {
+func CreateKindCluster(name string, bkc *config.BeKindConfig) error {
 	// If a config file is given, try to use that. Garbage in, garbage out though
 	// check if the config is actually there
-	installConfig := viper.GetString("kindConfig")
-	if installConfig == "" {
+	if bkc == nil || bkc.KindConfig == "" {
 		return errors.New("no valid config found")
 	}
+	installConfig, err := bkc.NodeKindConfig()
+	if err != nil {
+		return err
+	}
 
 	// If the image is not given, use the default image
+	kindImage := bkc.KindImageVersion
 	if kindImage == "" {
 		kindImage = kindConfig.Image
 	}
 
 	// Create a KIND instance and write out the kubeconfig in the specified location
-	err := Provider.Create(
+	err = Provider.Create(
 		name,
 		cluster.CreateWithRawConfig([]byte(installConfig)),
 		cluster.CreateWithDisplayUsage(false),
@@ -91,26 +108,159 @@ func ListKindClusters() ([]string, error) {
 	return Provider.List()
 }
 
-// LoadDockerImage loads a docker image into the KIND cluster
-func LoadDockerImage(images []string, clustername string, pull bool) error {
+// RestConfig returns the rest config and the kubeconfig context of the KIND cluster. They're
+// read from KIND itself, so they don't depend on the current context of the user's kubeconfig.
+func RestConfig(name string) (*rest.Config, string, error) {
+	kubeconfig, err := Provider.KubeConfig(name, false)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get kubeconfig for KIND cluster %s: %w", name, err)
+	}
+
+	cfg, err := clientcmd.Load([]byte(kubeconfig))
+	if err != nil {
+		return nil, "", err
+	}
+
+	rc, err := clientcmd.NewDefaultClientConfig(*cfg, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return rc, cfg.CurrentContext, nil
+}
+
+// ClusterInfo describes a running KIND cluster
+type ClusterInfo struct {
+	Name              string    `json:"name" yaml:"name"`
+	Nodes             int       `json:"nodes" yaml:"nodes"`
+	NodeImage         string    `json:"nodeImage" yaml:"nodeImage"`
+	KubernetesVersion string    `json:"kubernetesVersion" yaml:"kubernetesVersion"`
+	Created           time.Time `json:"created" yaml:"created"`
+}
+
+// DescribeKindCluster returns the node count, node image, Kubernetes version and creation
+// time of the KIND cluster, read from its control plane node
+func DescribeKindCluster(name string) (*ClusterInfo, error) {
+	clusterNodes, err := Provider.ListNodes(name)
+	if err != nil {
+		return nil, err
+	}
+	info := &ClusterInfo{Name: name, Nodes: len(clusterNodes)}
+
+	node, err := nodeutils.BootstrapControlPlaneNode(clusterNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	info.KubernetesVersion, err = nodeutils.KubeVersion(node)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nodes are containers, inspect them with the runtime images are loaded with
+	out, err := exec.Command(Images.Name(), "inspect", "--format", "{{.Config.Image}}|{{.Created}}", node.String()).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect node %s: %w", node.String(), err)
+	}
+	image, created, _ := strings.Cut(strings.TrimSpace(string(out)), "|")
+	info.NodeImage = image
+	info.Created, err = parseCreated(created)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// parseCreated parses the creation time of a container. Docker gives it as RFC 3339, podman
+// the way Go prints times.
+func parseCreated(created string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999 -0700 MST"} {
+		if t, err := time.Parse(layout, created); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("could not parse creation time %q", created)
+}
+
+// LoadDockerImage loads docker images into the nodes of the KIND cluster. Images are loaded
+// onto every node, unless the image says which nodes it goes on. Images can also be loaded
+// from tar archives and OCI layout directories on disk.
+func LoadDockerImage(images []config.Image, clustername string, pull bool) error {
+	if len(images) == 0 {
+		return errors.New("no images to load")
+	}
+
+	// Images from disk don't go through the local container runtime
+	var runtimeImages []string
+	files := make(map[string]config.Image)
+	for _, image := range images {
+		if image.IsFile() {
+			files[image.Name] = image
+			continue
+		}
+		runtimeImages = append(runtimeImages, image.Name)
+	}
+
 	// If we are pulling the images, do that first
-	if pull {
-		err := pullImages(images)
+	if pull && len(runtimeImages) != 0 {
+		err := pullImages(runtimeImages)
 		if err != nil {
 			return err
 		}
 	}
 	// Get the list of nodes in the cluster
-	nodes, err := Provider.ListNodes(clustername)
+	clusterNodes, err := Provider.ListNodes(clustername)
 	if err != nil {
 		return err
 	}
 
 	// If no nodes were returned, we have a problem
-	if len(nodes) == 0 {
+	if len(clusterNodes) == 0 {
 		return errors.New("no nodes found")
 	}
 
+	// Work out which images go on which node
+	nodeImages, err := imagesForNodes(images, clusterNodes)
+	if err != nil {
+		return err
+	}
+
+	// Get the IDs of the local images so we can tell if a node already has them
+	imageIDs := make(map[string]string)
+	for _, name := range runtimeImages {
+		id, err := Images.ImageID(name)
+		if err != nil {
+			return fmt.Errorf("image %s not present locally: %w", name, err)
+		}
+		imageIDs[name] = id
+	}
+
+	// Only load the images that are missing or different on each node
+	nodeFiles := make(map[string][]string)
+	for _, node := range clusterNodes {
+		var imgs []string
+		for _, name := range nodeImages[node.String()] {
+			if _, ok := files[name]; ok {
+				nodeFiles[node.String()] = append(nodeFiles[node.String()], name)
+				continue
+			}
+			imgs = append(imgs, name)
+		}
+
+		load, retag := missingImages(node, imgs, imageIDs, nodeutils.ImageTags)
+		for _, name := range retag {
+			// Same image under another tag, so tag it instead of loading it again
+			log.Infof("Image %s already present on node %s, adding the missing tag", name, node.String())
+			if err := nodeutils.ReTagImage(node, imageIDs[name], sanitizeImage(name)); err != nil {
+				log.Warnf("Failed to tag image %s on node %s, loading it instead: %v", name, node.String(), err)
+				load = append(load, name)
+			}
+		}
+		nodeImages[node.String()] = load
+	}
+
 	// Setup the tar path where the images will be saved
 	dir, err := fs.TempDir("", "images-tar")
 	if err != nil {
@@ -118,27 +268,196 @@ func LoadDockerImage(images []string, clustername string, pull bool) error {
 	}
 
 	defer os.RemoveAll(dir)
-	imagesTarPath := filepath.Join(dir, "images.tar")
-	// Save the images into a tar
-	err = save(images, imagesTarPath)
+
+	// Save a tar for each set of images, nodes that get the same images share it
+	tars := make(map[string]string)
+	for _, node := range clusterNodes {
+		imgs := nodeImages[node.String()]
+		key := strings.Join(imgs, " ")
+		if len(imgs) == 0 || tars[key] != "" {
+			continue
+		}
+
+		imagesTarPath := filepath.Join(dir, fmt.Sprintf("images-%d.tar", len(tars)))
+		err = save(imgs, imagesTarPath)
+		if err != nil {
+			return err
+		}
+		tars[key] = imagesTarPath
+	}
+
+	// Archives are loaded as they are, OCI layout directories need to be put in a tar first
+	for name, image := range files {
+		if image.IsArchive() {
+			tars[name] = image.Path()
+			continue
+		}
+
+		layoutTarPath := filepath.Join(dir, fmt.Sprintf("oci-layout-%d.tar", len(tars)))
+		if err := tarDirectory(image.Path(), layoutTarPath); err != nil {
+			return fmt.Errorf("failed to archive OCI layout %s: %w", image.Path(), err)
+		}
+		tars[name] = layoutTarPath
+	}
+
+	// Load the images on the selected nodes, a few at a time
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	sem := make(chan struct{}, maxParallelLoads)
+	for _, selectedNode := range clusterNodes {
+		var nodeTars []string
+		if imgs := nodeImages[selectedNode.String()]; len(imgs) != 0 {
+			nodeTars = append(nodeTars, tars[strings.Join(imgs, " ")])
+		}
+		for _, name := range nodeFiles[selectedNode.String()] {
+			nodeTars = append(nodeTars, tars[name])
+		}
+		if len(nodeTars) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(node nodes.Node, nodeTars []string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			for _, tar := range nodeTars {
+				if err := loadImage(tar, node); err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("failed to load %s on node %s: %w", tar, node.String(), err))
+					mu.Unlock()
+				}
+			}
+		}(selectedNode, nodeTars)
+	}
+	wg.Wait()
+
+	// If we are here we should be okay, unless any of the nodes failed
+	return errors.Join(errs...)
+}
+
+// imagesForNodes returns the names of the images to load onto each node, keyed by node name
+func imagesForNodes(images []config.Image, clusterNodes []nodes.Node) (map[string][]string, error) {
+	nodeImages := make(map[string][]string)
+	matched := make(map[string]bool)
+	for _, node := range clusterNodes {
+		role, err := node.Role()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role of node %s: %w", node.String(), err)
+		}
+
+		for _, image := range images {
+			if image.OnNode(node.String(), role) {
+				nodeImages[node.String()] = append(nodeImages[node.String()], image.Name)
+				matched[image.Name] = true
+			}
+		}
+	}
+
+	// An image that goes nowhere is most likely a typo in the node selector
+	var errs []error
+	for _, image := range images {
+		if !matched[image.Name] {
+			errs = append(errs, fmt.Errorf("image %s does not match any node in %v", image.Name, image.Nodes))
+		}
+	}
+
+	return nodeImages, errors.Join(errs...)
+}
+
+// missingImages returns the images that need to be loaded onto the node, and the images the
+// node already has under a different tag
+func missingImages(node nodes.Node, images []string, imageIDs map[string]string, tagFetcher imageTagFetcher) (load []string, retag []string) {
+	for _, name := range images {
+		tags, err := tagFetcher(node, imageIDs[name])
+		switch {
+		case err != nil || len(tags) == 0:
+			load = append(load, name)
+		case tags[sanitizeImage(name)]:
+			log.Debugf("Image %s already present on node %s, skipping", name, node.String())
+		default:
+			retag = append(retag, name)
+		}
+	}
+
+	return load, retag
+}
+
+// sanitizeImage returns the fully qualified image name, which is how containerd on the node tags it
+func sanitizeImage(image string) string {
+	name := image
+	if !strings.ContainsRune(name, '/') {
+		name = "library/" + name
+	}
+
+	i := strings.IndexRune(name, '/')
+	if !strings.ContainsAny(name[:i], ".:") && name[:i] != "localhost" {
+		name = "docker.io/" + name
+	}
+
+	if !strings.ContainsRune(name[strings.LastIndex(name, "/")+1:], ':') && !strings.ContainsRune(name, '@') {
+		name += ":latest"
+	}
+
+	return name
+}
+
+// tarDirectory writes the contents of the directory src into a tar archive at dest
+func tarDirectory(src string, dest string) error {
+	f, err := os.Create(dest)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	err = filepath.WalkDir(src, func(path string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
 
-	// Load the images on the selected nodes
-	for _, selectedNode := range nodes {
-		selectedNode := selectedNode // capture loop variable
-		return loadImage(imagesTarPath, selectedNode)
+		r, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
-	// If we are here we should be okay
-	return nil
+	return tw.Close()
 }
 
-// save saves images to dest, as in `docker save`
+// save saves images to dest using the image source
 func save(images []string, dest string) error {
-	commandArgs := append([]string{"save", "-o", dest}, images...)
-	return exec.Command("docker", commandArgs...).Run()
+	return Images.Save(images, dest)
 }
 
 // loadImage loads an image tarball onto a node
@@ -154,7 +473,7 @@ func loadImage(imageTarName string, node nodes.Node) error {
 // pullImages pulls images locally so that they can be loaded into the cluster
 func pullImages(images []string) error {
 	for _, image := range images {
-		err := exec.Command("docker", "pull", image).Run()
+		err := Images.Pull(image)
 		if err != nil {
 			return errors.New("failed to pull image: " + image)
 		}
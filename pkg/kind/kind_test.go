@@ -16,11 +16,18 @@ limitations under the License.
 package kind
 
 import (
+	"archive/tar"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/spf13/viper"
+	"github.com/christianh814/bekind/pkg/config"
 	"sigs.k8s.io/kind/pkg/cluster"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
 )
 
 func TestProviderInitialization(t *testing.T) {
@@ -38,19 +45,8 @@ func TestProviderInitialization(t *testing.T) {
 func TestCreateKindCluster(t *testing.T) {
 	// Test CreateKindCluster function with invalid config
 
-	// Save original viper state
-	originalSettings := viper.AllSettings()
-	defer func() {
-		viper.Reset()
-		for k, v := range originalSettings {
-			viper.Set(k, v)
-		}
-	}()
-
-	viper.Reset()
-
 	// Test with no kindConfig
-	err := CreateKindCluster("test-cluster", "")
+	err := CreateKindCluster("test-cluster", config.New())
 	if err == nil {
 		t.Error("CreateKindCluster should fail when no kindConfig is provided")
 	}
@@ -64,30 +60,19 @@ func TestCreateKindCluster(t *testing.T) {
 func TestCreateKindClusterWithConfig(t *testing.T) {
 	// Test CreateKindCluster with a valid-looking config
 
-	// Save original viper state
-	originalSettings := viper.AllSettings()
-	defer func() {
-		viper.Reset()
-		for k, v := range originalSettings {
-			viper.Set(k, v)
-		}
-	}()
-
-	viper.Reset()
-
 	// Set a valid-looking KIND config
-	kindConfig := `
+	bkc := config.New()
+	bkc.KindConfig = `
 kind: Cluster
 apiVersion: kind.x-k8s.io/v1alpha4
 name: test-cluster
 nodes:
 - role: control-plane
 `
-	viper.Set("kindConfig", kindConfig)
 
 	// This will likely fail in CI environment without Docker/KIND
 	// but should not panic and should handle the error gracefully
-	err := CreateKindCluster("test-cluster", "")
+	err := CreateKindCluster("test-cluster", bkc)
 
 	// We expect this to fail in test environment, but not panic
 	if err != nil {
@@ -142,23 +127,225 @@ func TestLoadDockerImage(t *testing.T) {
 	// Test LoadDockerImage function parameter validation
 
 	// Test with empty images slice
-	err := LoadDockerImage([]string{}, "test-cluster", false)
+	err := LoadDockerImage([]config.Image{}, "test-cluster", false)
 	if err == nil {
 		t.Error("LoadDockerImage should fail with empty images slice")
 	}
 
 	// Test with empty cluster name
-	err = LoadDockerImage([]string{"nginx:latest"}, "", false)
+	err = LoadDockerImage([]config.Image{{Name: "nginx:latest"}}, "", false)
 	if err == nil {
 		t.Error("LoadDockerImage should fail with empty cluster name")
 	}
 
 	// Test with valid parameters (will fail in test environment)
-	err = LoadDockerImage([]string{"nginx:latest"}, "test-cluster", false)
+	err = LoadDockerImage([]config.Image{{Name: "nginx:latest"}}, "test-cluster", false)
 	// This is expected to fail in test environment
 	_ = err
 }
 
+// fakeNode is a node with a name and role, anything else panics
+type fakeNode struct {
+	nodes.Node
+	name string
+	role string
+}
+
+func (n fakeNode) String() string {
+	return n.name
+}
+
+func (n fakeNode) Role() (string, error) {
+	return n.role, nil
+}
+
+func TestImagesForNodes(t *testing.T) {
+	clusterNodes := []nodes.Node{
+		fakeNode{name: "kind-control-plane", role: "control-plane"},
+		fakeNode{name: "kind-worker", role: "worker"},
+		fakeNode{name: "kind-worker2", role: "worker"},
+	}
+
+	images := []config.Image{
+		{Name: "nginx:1.25"},
+		{Name: "redis:7", Nodes: []string{"worker"}},
+		{Name: "postgres:15", Nodes: []string{"kind-worker2"}},
+	}
+
+	nodeImages, err := imagesForNodes(images, clusterNodes)
+	if err != nil {
+		t.Fatalf("imagesForNodes() returned error: %v", err)
+	}
+
+	expected := map[string]string{
+		"kind-control-plane": "nginx:1.25",
+		"kind-worker":        "nginx:1.25 redis:7",
+		"kind-worker2":       "nginx:1.25 redis:7 postgres:15",
+	}
+	for node, want := range expected {
+		if got := strings.Join(nodeImages[node], " "); got != want {
+			t.Errorf("Expected images '%s' on %s, got '%s'", want, node, got)
+		}
+	}
+
+	// A selector that matches nothing is an error
+	_, err = imagesForNodes([]config.Image{{Name: "nginx:1.25", Nodes: []string{"wroker"}}}, clusterNodes)
+	if err == nil {
+		t.Error("imagesForNodes should fail when an image matches no node")
+	}
+}
+
+func TestMissingImages(t *testing.T) {
+	node := fakeNode{name: "kind-worker", role: "worker"}
+	imageIDs := map[string]string{
+		"nginx:1.25":       "sha256:aaa",
+		"redis:7":          "sha256:bbb",
+		"my-app:dev":       "sha256:ccc",
+		"quay.io/app:v1.0": "sha256:ddd",
+	}
+
+	// What the node has in its image store, by image ID
+	var tagFetcher imageTagFetcher = func(n nodes.Node, id string) (map[string]bool, error) {
+		switch id {
+		case "sha256:aaa":
+			return map[string]bool{"docker.io/library/nginx:1.25": true}, nil
+		case "sha256:bbb":
+			return map[string]bool{"docker.io/library/redis:latest": true}, nil
+		case "sha256:ddd":
+			return nil, errors.New("ctr failed")
+		}
+		return map[string]bool{}, nil
+	}
+
+	load, retag := missingImages(node, []string{"nginx:1.25", "redis:7", "my-app:dev", "quay.io/app:v1.0"}, imageIDs, tagFetcher)
+
+	if strings.Join(load, " ") != "my-app:dev quay.io/app:v1.0" {
+		t.Errorf("Expected missing images to be loaded, got %v", load)
+	}
+	if strings.Join(retag, " ") != "redis:7" {
+		t.Errorf("Expected redis:7 to be retagged, got %v", retag)
+	}
+}
+
+func TestSanitizeImage(t *testing.T) {
+	testCases := map[string]string{
+		"nginx":                        "docker.io/library/nginx:latest",
+		"nginx:1.25":                   "docker.io/library/nginx:1.25",
+		"christianh814/simple-go":      "docker.io/christianh814/simple-go:latest",
+		"quay.io/christianh814/app:v1": "quay.io/christianh814/app:v1",
+		"localhost/app":                "localhost/app:latest",
+		"localhost:5000/app":           "localhost:5000/app:latest",
+		"registry.local:5000/app:dev":  "registry.local:5000/app:dev",
+		"nginx@sha256:abc":             "docker.io/library/nginx@sha256:abc",
+	}
+
+	for image, expected := range testCases {
+		if got := sanitizeImage(image); got != expected {
+			t.Errorf("Expected sanitizeImage(%s) to be '%s', got '%s'", image, expected, got)
+		}
+	}
+}
+
+func TestParseCreated(t *testing.T) {
+	expected := time.Date(2026, 1, 2, 3, 4, 5, 123000000, time.UTC)
+
+	// Docker and podman print the creation time differently
+	for _, created := range []string{"2026-01-02T03:04:05.123Z", "2026-01-02 03:04:05.123 +0000 UTC"} {
+		got, err := parseCreated(created)
+		if err != nil {
+			t.Errorf("parseCreated(%s) returned error: %v", created, err)
+			continue
+		}
+		if !got.Equal(expected) {
+			t.Errorf("Expected parseCreated(%s) to be %v, got %v", created, expected, got)
+		}
+	}
+
+	if _, err := parseCreated("yesterday"); err == nil {
+		t.Error("Expected an error for a bad creation time")
+	}
+}
+
+func TestTarDirectory(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"oci-layout":              `{"imageLayoutVersion": "1.0.0"}`,
+		"index.json":              `{"schemaVersion": 2}`,
+		"blobs/sha256/0123456789": "blob",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	dest := filepath.Join(t.TempDir(), "layout.tar")
+	if err := tarDirectory(src, dest); err != nil {
+		t.Fatalf("tarDirectory() returned error: %v", err)
+	}
+
+	f, err := os.Open(dest)
+	if err != nil {
+		t.Fatalf("Failed to open tar: %v", err)
+	}
+	defer f.Close()
+
+	// Files should be at the top of the archive, with their content
+	found := make(map[string]string)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read tar: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", hdr.Name, err)
+		}
+		found[hdr.Name] = string(data)
+	}
+
+	for name, content := range files {
+		if found[name] != content {
+			t.Errorf("Expected '%s' with content '%s' in the tar, got '%s'", name, content, found[name])
+		}
+	}
+
+	if err := tarDirectory(filepath.Join(src, "missing"), dest); err == nil {
+		t.Error("tarDirectory should fail with a missing directory")
+	}
+}
+
+func TestRegistryHosts(t *testing.T) {
+	bkc := config.New()
+	if hosts := registryHosts(bkc); len(hosts) != 0 {
+		t.Errorf("Expected no registry hosts, got %v", hosts)
+	}
+
+	bkc.LocalRegistry = &config.LocalRegistry{Port: 5005}
+	bkc.RegistryMirrors = []config.RegistryMirror{{Registry: "docker.io"}, {Registry: "quay.io"}}
+	hosts := registryHosts(bkc)
+	if len(hosts) != 3 {
+		t.Fatalf("Expected 3 registry hosts, got %v", hosts)
+	}
+	if !strings.Contains(hosts["localhost:5005"], "http://kind-registry:5000") {
+		t.Errorf("Expected local registry host config, got %s", hosts["localhost:5005"])
+	}
+	if !strings.Contains(hosts["docker.io"], "http://kind-mirror-docker-io:5000") {
+		t.Errorf("Expected docker.io mirror host config, got %s", hosts["docker.io"])
+	}
+}
+
 func TestSaveFunction(t *testing.T) {
 	// Test save function exists and handles parameters correctly
 	// We can't test actual Docker save in CI, but we can test parameter validation
@@ -227,14 +414,16 @@ func TestKindImageHandling(t *testing.T) {
 	// Test KIND image version handling
 
 	// Test with empty image (should use default)
-	err := CreateKindCluster("test", "")
+	err := CreateKindCluster("test", config.New())
 	if err != nil && err.Error() == "no valid config found" {
 		// This is expected - we're testing the image parameter handling
 		// before the config validation
 	}
 
 	// Test with specific image version
-	err = CreateKindCluster("test", "kindest/node:v1.25.0")
+	bkc := config.New()
+	bkc.KindImageVersion = "kindest/node:v1.25.0"
+	err = CreateKindCluster("test", bkc)
 	if err != nil && err.Error() == "no valid config found" {
 		// This is expected - we're testing the image parameter handling
 		// before the config validation
@@ -252,7 +441,7 @@ func TestErrorHandling(t *testing.T) {
 			name: "CreateKindCluster with empty config",
 			testFunc: func() error {
 				// This will likely fail due to missing config
-				return CreateKindCluster("test", "")
+				return CreateKindCluster("test", config.New())
 			},
 			expectError: true,
 		},
@@ -267,7 +456,7 @@ func TestErrorHandling(t *testing.T) {
 		{
 			name: "LoadDockerImage with empty images",
 			testFunc: func() error {
-				return LoadDockerImage([]string{}, "test", false)
+				return LoadDockerImage([]config.Image{}, "test", false)
 			},
 			expectError: true,
 		},
@@ -286,6 +475,73 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestGetImageSource(t *testing.T) {
+	testCases := map[string]string{
+		"":             "docker",
+		"docker":       "docker",
+		"podman":       "podman",
+		"nerdctl":      "nerdctl",
+		"finch":        "finch",
+		"nerdctl.lima": "nerdctl.lima",
+		"invalid":      "docker",
+	}
+
+	// Only docker is installed, so it's the fallback
+	fakeRuntimes(t, "docker")
+	for provider, expected := range testCases {
+		t.Setenv("KIND_EXPERIMENTAL_PROVIDER", provider)
+		if got := GetImageSource().Name(); got != expected {
+			t.Errorf("Expected image source '%s' for provider '%s', got '%s'", expected, provider, got)
+		}
+	}
+
+	// Podman needs its own handling for saving and image IDs
+	t.Setenv("KIND_EXPERIMENTAL_PROVIDER", "podman")
+	if _, ok := GetImageSource().(podmanImages); !ok {
+		t.Error("Expected podman image source for the podman provider")
+	}
+}
+
+func TestGetImageSourceDetected(t *testing.T) {
+	t.Setenv("KIND_EXPERIMENTAL_PROVIDER", "")
+
+	// Detected in the same order as KIND detects its node provider
+	testCases := []struct {
+		installed []string
+		expected  string
+	}{
+		{installed: []string{"docker", "nerdctl", "podman"}, expected: "docker"},
+		{installed: []string{"nerdctl", "podman"}, expected: "nerdctl"},
+		{installed: []string{"podman"}, expected: "podman"},
+		{installed: nil, expected: "docker"},
+	}
+
+	for _, tc := range testCases {
+		fakeRuntimes(t, tc.installed...)
+		if got := GetImageSource().Name(); got != tc.expected {
+			t.Errorf("Expected image source '%s' with %v installed, got '%s'", tc.expected, tc.installed, got)
+		}
+	}
+
+	fakeRuntimes(t, "podman")
+	if _, ok := GetImageSource().(podmanImages); !ok {
+		t.Error("Expected podman image source when only podman is installed")
+	}
+}
+
+// fakeRuntimes sets the PATH to a directory with only the given runtimes in it
+func fakeRuntimes(t *testing.T, runtimes ...string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, r := range runtimes {
+		if err := os.WriteFile(filepath.Join(dir, r), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("Failed to create fake %s: %v", r, err)
+		}
+	}
+	t.Setenv("PATH", dir)
+}
+
 func TestEnvironmentVariableHandling(t *testing.T) {
 	// Test KIND_EXPERIMENTAL_PROVIDER environment variable handling
 	// This is tested indirectly through utils.GetDefaultRuntime()
@@ -0,0 +1,144 @@
+package kind
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/christianh814/bekind/pkg/config"
+	"sigs.k8s.io/kind/pkg/cluster/nodeutils"
+)
+
+// kindNetwork is the network KIND puts the cluster nodes on
+const kindNetwork = "kind"
+
+// StartLocalRegistry starts the registry container on the kind network, if it isn't already running
+func StartLocalRegistry(r *config.LocalRegistry) error {
+	return startRegistryContainer(r.ContainerName(),
+		"-p", fmt.Sprintf("127.0.0.1:%d:5000", r.HostPort()),
+		r.ContainerImage(),
+	)
+}
+
+// StartRegistryMirror starts the pull-through cache container for the mirror on the kind
+// network, if it isn't already running. The container is kept between clusters.
+func StartRegistryMirror(m config.RegistryMirror) error {
+	return startRegistryContainer(m.ContainerName(),
+		"-e", "REGISTRY_PROXY_REMOTEURL="+m.RemoteURL(),
+		m.ContainerImage(),
+	)
+}
+
+// ConfigureRegistries points containerd on every node of the cluster at the local registry and mirrors
+func ConfigureRegistries(clustername string, bkc *config.BeKindConfig) error {
+	hosts := registryHosts(bkc)
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	clusterNodes, err := Provider.ListNodes(clustername)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range clusterNodes {
+		for host, toml := range hosts {
+			if err := nodeutils.WriteFile(node, config.RegistryHostsFile(host), toml); err != nil {
+				return fmt.Errorf("failed to configure registry %s on node %s: %w", host, node.String(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// LocalRegistryInUse checks if any KIND cluster, other than the one given, pulls from the registry
+func LocalRegistryInUse(r *config.LocalRegistry, exclude string) (bool, error) {
+	clusters, err := ListKindClusters()
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range clusters {
+		if c == exclude {
+			continue
+		}
+		clusterNodes, err := Provider.ListNodes(c)
+		if err != nil {
+			return false, err
+		}
+
+		// The registry is in use if a node has the host config pointing at it
+		for _, node := range clusterNodes {
+			var out strings.Builder
+			if err := node.Command("cat", config.RegistryHostsFile(r.Host())).SetStdout(&out).Run(); err != nil {
+				continue
+			}
+			if out.String() == r.HostsTOML() {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// DeleteLocalRegistry removes the registry container
+func DeleteLocalRegistry(r *config.LocalRegistry) error {
+	out, err := exec.Command(Images.Name(), "rm", "-f", r.ContainerName()).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to delete registry %s: %s", r.ContainerName(), strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// registryHosts returns the containerd host configs for the local registry and mirrors, keyed by host
+func registryHosts(bkc *config.BeKindConfig) map[string]string {
+	hosts := make(map[string]string)
+	if r := bkc.LocalRegistry; r != nil {
+		hosts[r.Host()] = r.HostsTOML()
+	}
+	for _, m := range bkc.RegistryMirrors {
+		hosts[m.Registry] = m.HostsTOML()
+	}
+
+	return hosts
+}
+
+// startRegistryContainer starts a registry container on the kind network, creating it with the
+// given run arguments if it isn't there. The last argument is the image.
+func startRegistryContainer(name string, runArgs ...string) error {
+	runtime := Images.Name()
+
+	running, err := exec.Command(runtime, "inspect", "-f", "{{ .State.Running }}", name).Output()
+	switch {
+	case err != nil:
+		// The container isn't there, so create it
+		args := append([]string{"run", "-d", "--restart=always", "--network", kindNetwork, "--name", name}, runArgs...)
+		if out, err := exec.Command(runtime, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to start registry %s: %s", name, strings.TrimSpace(string(out)))
+		}
+		return nil
+	case strings.TrimSpace(string(running)) != "true":
+		if out, err := exec.Command(runtime, "start", name).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to start registry %s: %s", name, strings.TrimSpace(string(out)))
+		}
+	}
+
+	// An existing registry may have been started before the kind network was there
+	networks, err := exec.Command(runtime, "inspect", "-f", "{{ range $k, $v := .NetworkSettings.Networks }}{{ $k }} {{ end }}", name).Output()
+	if err != nil {
+		return err
+	}
+	for _, n := range strings.Fields(string(networks)) {
+		if n == kindNetwork {
+			return nil
+		}
+	}
+	if out, err := exec.Command(runtime, "network", "connect", kindNetwork, name).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to connect registry %s to the %s network: %s", name, kindNetwork, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
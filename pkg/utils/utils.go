@@ -3,16 +3,20 @@ package utils
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/christianh814/bekind/pkg/config"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	goyaml "gopkg.in/yaml.v2"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -30,25 +34,51 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/jsonpath"
 	"sigs.k8s.io/kind/pkg/cluster"
 )
 
 var decUnstructured = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
 
-// GetDefault selected the default runtime from the environment override
+// runtimes are the container runtimes to look for, in the order KIND detects them
+var runtimes = []string{"docker", "nerdctl", "podman"}
+
+// DetectRuntime returns the container runtime to use. KIND_EXPERIMENTAL_PROVIDER wins when set,
+// otherwise it's the first of docker, nerdctl and podman found in the PATH, like KIND does.
+func DetectRuntime() string {
+	switch p := os.Getenv("KIND_EXPERIMENTAL_PROVIDER"); p {
+	case "podman", "docker", "nerdctl", "finch", "nerdctl.lima":
+		return p
+	}
+
+	for _, r := range runtimes {
+		if _, err := exec.LookPath(r); err == nil {
+			return r
+		}
+	}
+
+	// KIND falls back to docker when it can't find anything either
+	return "docker"
+}
+
+// GetDefault selected the default runtime from DetectRuntime, so the KIND provider
+// and the images loaded into it always come from the same runtime
 func GetDefaultRuntime() cluster.ProviderOption {
 	switch p := os.Getenv("KIND_EXPERIMENTAL_PROVIDER"); p {
 	case "":
-		return nil
+	case "podman", "docker", "nerdctl", "finch", "nerdctl.lima":
+		log.Warnf("using %s due to KIND_EXPERIMENTAL_PROVIDER", p)
+	default:
+		log.Warnf("ignoring unknown value %q for KIND_EXPERIMENTAL_PROVIDER", p)
+	}
+
+	switch r := DetectRuntime(); r {
 	case "podman":
-		log.Warn("using podman due to KIND_EXPERIMENTAL_PROVIDER")
 		return cluster.ProviderWithPodman()
 	case "docker":
-		log.Warn("using docker due to KIND_EXPERIMENTAL_PROVIDER")
 		return cluster.ProviderWithDocker()
 	default:
-		log.Warnf("ignoring unknown value %q for KIND_EXPERIMENTAL_PROVIDER", p)
-		return nil
+		return cluster.ProviderWithNerdctl(r)
 	}
 }
 
@@ -296,59 +326,47 @@ func PostInstallManifests(manifests []string, ctx context.Context, cfg *rest.Con
 	return nil
 }
 
-// PostInstallAction represents an action to be executed after installation
-type PostInstallAction struct {
-	Action        string            `mapstructure:"action"`
-	Group         string            `mapstructure:"group"`
-	Version       string            `mapstructure:"version"`
-	Kind          string            `mapstructure:"kind"`
-	Name          string            `mapstructure:"name"`
-	Namespace     string            `mapstructure:"namespace"`
-	LabelSelector map[string]string `mapstructure:"labelSelector"`
+// GetManifestObjects returns the objects in a post install manifest without applying them
+func GetManifestObjects(m string) ([]*unstructured.Unstructured, error) {
+	// Get the bytes from the manifest
+	data, err := getPostInstallBytes(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// Split the YAML into a slice of bytes
+	yamls, err := SplitYAML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode each YAML into an object
+	var objs []*unstructured.Unstructured
+	for _, y := range yamls {
+		obj := &unstructured.Unstructured{}
+		if _, _, err := decUnstructured.Decode(y, nil, obj); err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+
+	return objs, nil
 }
 
-// PostInstallActions executes post-install actions on Kubernetes resources
+// PostInstallAction represents an action to be executed after installation
+type PostInstallAction = config.PostInstallAction
+
+// PostInstallActions executes post-install actions on Kubernetes resources. Invalid actions are
+// skipped, the errors of the actions that failed are returned together.
 func PostInstallActions(actions []PostInstallAction, ctx context.Context, cfg *rest.Config) error {
-	// Validate and execute each action
+	// Validate and execute each action, carrying on with the rest if one fails
+	var errs []error
 	for _, action := range actions {
-		// Validate required fields
-		if action.Action == "" {
-			log.Warn("Skipping action with empty 'action' field")
+		// Skip anything that isn't supported
+		if err := action.Validate(); err != nil {
+			log.Warnf("Skipping action: %v", err)
 			continue
 		}
-		if action.Kind == "" {
-			log.Warn("Skipping action with empty 'kind' field")
-			continue
-		}
-		// Either name or labelSelector must be provided
-		if action.Name == "" && len(action.LabelSelector) == 0 {
-			log.Warn("Skipping action with empty 'name' and 'labelSelector' fields - at least one is required")
-			continue
-		}
-
-		// Validate action type
-		if action.Action != "restart" && action.Action != "delete" {
-			log.Warnf("Skipping unsupported action '%s' for %s/%s", action.Action, action.Kind, action.Name)
-			continue
-		}
-
-		// Validate kind based on action
-		if action.Action == "restart" {
-			validKinds := map[string]bool{
-				"Deployment":  true,
-				"StatefulSet": true,
-				"DaemonSet":   true,
-			}
-			if !validKinds[action.Kind] {
-				log.Warnf("Skipping unsupported kind '%s' for restart action", action.Kind)
-				continue
-			}
-		} else if action.Action == "delete" {
-			if action.Kind != "Pod" {
-				log.Warnf("Skipping unsupported kind '%s' for delete action - only Pod is supported", action.Kind)
-				continue
-			}
-		}
 
 		// Set defaults
 		group := action.Group
@@ -380,7 +398,9 @@ func PostInstallActions(actions []PostInstallAction, ctx context.Context, cfg *r
 				// Restart by label selector
 				log.Infof("Restarting %s(s) with labels %v in namespace %s", action.Kind, action.LabelSelector, namespace)
 				if err := restartResourcesByLabel(ctx, cfg, group, version, action.Kind, namespace, action.LabelSelector); err != nil {
-					log.Warnf("Failed to restart %s(s) by label: %v", action.Kind, err)
+					err = fmt.Errorf("failed to restart %s(s) by label: %w", action.Kind, err)
+					log.Warn(err)
+					errs = append(errs, err)
 					continue
 				}
 				log.Infof("Successfully restarted %s(s) by label selector", action.Kind)
@@ -388,7 +408,9 @@ func PostInstallActions(actions []PostInstallAction, ctx context.Context, cfg *r
 				// Restart by name
 				log.Infof("Restarting %s/%s in namespace %s", action.Kind, action.Name, namespace)
 				if err := restartResource(ctx, cfg, group, version, action.Kind, action.Name, namespace); err != nil {
-					log.Warnf("Failed to restart %s/%s: %v", action.Kind, action.Name, err)
+					err = fmt.Errorf("failed to restart %s/%s: %w", action.Kind, action.Name, err)
+					log.Warn(err)
+					errs = append(errs, err)
 					continue
 				}
 				log.Infof("Successfully restarted %s/%s", action.Kind, action.Name)
@@ -399,7 +421,9 @@ func PostInstallActions(actions []PostInstallAction, ctx context.Context, cfg *r
 				// Delete by label selector
 				log.Infof("Deleting %s(s) with labels %v in namespace %s", action.Kind, action.LabelSelector, namespace)
 				if err := deleteResourcesByLabel(ctx, cfg, group, version, action.Kind, namespace, action.LabelSelector); err != nil {
-					log.Warnf("Failed to delete %s(s) by label: %v", action.Kind, err)
+					err = fmt.Errorf("failed to delete %s(s) by label: %w", action.Kind, err)
+					log.Warn(err)
+					errs = append(errs, err)
 					continue
 				}
 				log.Infof("Successfully deleted %s(s) by label selector", action.Kind)
@@ -407,7 +431,9 @@ func PostInstallActions(actions []PostInstallAction, ctx context.Context, cfg *r
 				// Delete by name
 				log.Infof("Deleting %s/%s in namespace %s", action.Kind, action.Name, namespace)
 				if err := deleteResource(ctx, cfg, group, version, action.Kind, action.Name, namespace); err != nil {
-					log.Warnf("Failed to delete %s/%s: %v", action.Kind, action.Name, err)
+					err = fmt.Errorf("failed to delete %s/%s: %w", action.Kind, action.Name, err)
+					log.Warn(err)
+					errs = append(errs, err)
 					continue
 				}
 				log.Infof("Successfully deleted %s/%s", action.Kind, action.Name)
@@ -415,7 +441,7 @@ func PostInstallActions(actions []PostInstallAction, ctx context.Context, cfg *r
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 // restartResource performs a rollout restart on a Kubernetes resource
@@ -651,9 +677,9 @@ func deleteResourcesByLabel(ctx context.Context, cfg *rest.Config, group, versio
 }
 
 // SaveBeKindConfig saves the bekind config to a Kubernetes secret
-func SaveBeKindConfig(cfg *rest.Config, ctx context.Context, ns string, name string) error {
+func SaveBeKindConfig(cfg *rest.Config, ctx context.Context, ns string, name string, bkc *config.BeKindConfig) error {
 	// Get the Byteslice of the config
-	bekindconfigByteSlice, err := goyaml.Marshal(viper.AllSettings())
+	bekindconfigByteSlice, err := bkc.Marshal()
 	if err != nil {
 		return err
 	}
@@ -676,8 +702,11 @@ func SaveBeKindConfig(cfg *rest.Config, ctx context.Context, ns string, name str
 		Type: corev1.SecretTypeOpaque, // Default secret type
 	}
 
-	// Create the secret
+	// Create the secret, or update it if this is a re-run against the same cluster
 	_, err = client.CoreV1().Secrets(ns).Create(ctx, secret, v1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = client.CoreV1().Secrets(ns).Update(ctx, secret, v1.UpdateOptions{})
+	}
 	if err != nil {
 		return err
 	}
@@ -686,6 +715,169 @@ func SaveBeKindConfig(cfg *rest.Config, ctx context.Context, ns string, name str
 	return nil
 }
 
+// SaveCompletedSteps records the start steps that have completed in a ConfigMap on the cluster
+func SaveCompletedSteps(client kubernetes.Interface, ctx context.Context, ns string, name string, steps []string) error {
+	// Set up the configmap
+	cm := &corev1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+		},
+		Data: map[string]string{
+			"completed": strings.Join(steps, ","),
+		},
+	}
+
+	// Create the configmap, or update it if it's already there
+	_, err := client.CoreV1().ConfigMaps(ns).Create(ctx, cm, v1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = client.CoreV1().ConfigMaps(ns).Update(ctx, cm, v1.UpdateOptions{})
+	}
+
+	return err
+}
+
+// SaveLocalRegistryHosting publishes the local registry in the "local-registry-hosting" ConfigMap,
+// so tools running against the cluster know where to push images
+func SaveLocalRegistryHosting(cfg *rest.Config, ctx context.Context, ns string, host string) error {
+	// Create Kubernetes cilent
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Set up the configmap, see https://github.com/kubernetes/enhancements/tree/master/keps/sig-cluster-lifecycle/generic/1755-communicating-a-local-registry
+	cm := &corev1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "local-registry-hosting",
+			Namespace: ns,
+		},
+		Data: map[string]string{
+			"localRegistryHosting.v1": fmt.Sprintf("host: %q\nhelp: \"https://kind.sigs.k8s.io/docs/user/local-registry/\"\n", host),
+		},
+	}
+
+	// Create the configmap, or update it if it's already there
+	_, err = client.CoreV1().ConfigMaps(ns).Create(ctx, cm, v1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = client.CoreV1().ConfigMaps(ns).Update(ctx, cm, v1.UpdateOptions{})
+	}
+
+	return err
+}
+
+// GetCompletedSteps returns the start steps recorded as completed on the cluster. No steps
+// are returned if nothing was recorded yet.
+func GetCompletedSteps(client kubernetes.Interface, ctx context.Context, ns string, name string) ([]string, error) {
+	// Get the configmap
+	cm, err := client.CoreV1().ConfigMaps(ns).Get(ctx, name, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cm.Data["completed"] == "" {
+		return nil, nil
+	}
+
+	return strings.Split(cm.Data["completed"], ","), nil
+}
+
+// outputResources are the resources outputs can be read from, by kind
+var outputResources = map[string]schema.GroupVersionResource{
+	"Secret":    {Version: "v1", Resource: "secrets"},
+	"ConfigMap": {Version: "v1", Resource: "configmaps"},
+	"Ingress":   {Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+	"HTTPRoute": {Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"},
+	"Service":   {Version: "v1", Resource: "services"},
+}
+
+// GetOutput reads the value of the output from its object on the cluster. The error is a
+// NotFound error if the object isn't there.
+func GetOutput(cfg *rest.Config, ctx context.Context, o config.Output) (string, error) {
+	// Create dynamic client
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	return getOutput(ctx, dyn, o)
+}
+
+// getOutput reads the value of the output with the given dynamic client
+func getOutput(ctx context.Context, dyn dynamic.Interface, o config.Output) (string, error) {
+	kind, name := o.Object()
+	gvr, ok := outputResources[kind]
+	if !ok {
+		return "", fmt.Errorf("output %q: no object to read from", o.Name)
+	}
+	namespace := o.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	obj, err := dyn.Resource(gvr).Namespace(namespace).Get(ctx, name, v1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	var value string
+	switch {
+	case o.JSONPath != "":
+		j := jsonpath.New(o.Name)
+		if err := j.Parse(o.JSONPath); err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := j.Execute(&buf, obj.Object); err != nil {
+			return "", fmt.Errorf("%s %s/%s: %w", kind, namespace, name, err)
+		}
+		value = buf.String()
+	case kind == "Secret":
+		data, _, _ := unstructured.NestedString(obj.Object, "data", o.Key)
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return "", err
+		}
+		value = string(decoded)
+	case kind == "ConfigMap":
+		value, _, _ = unstructured.NestedString(obj.Object, "data", o.Key)
+	case kind == "Ingress":
+		rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+		if len(rules) != 0 {
+			value, _, _ = unstructured.NestedString(rules[0].(map[string]interface{}), "host")
+		}
+	case kind == "HTTPRoute":
+		hostnames, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "hostnames")
+		if len(hostnames) != 0 {
+			value = hostnames[0]
+		}
+	case kind == "Service":
+		// The port given by name or number, or the first one
+		ports, _, _ := unstructured.NestedSlice(obj.Object, "spec", "ports")
+		for _, p := range ports {
+			port := p.(map[string]interface{})
+			portName, _, _ := unstructured.NestedString(port, "name")
+			portNumber, _, _ := unstructured.NestedInt64(port, "port")
+			if o.Port != "" && o.Port != portName && o.Port != strconv.FormatInt(portNumber, 10) {
+				continue
+			}
+			if nodePort, found, _ := unstructured.NestedInt64(port, "nodePort"); found {
+				value = strconv.FormatInt(nodePort, 10)
+			}
+			break
+		}
+	}
+
+	if value == "" {
+		return "", fmt.Errorf("output %q: nothing found in %s %s/%s", o.Name, kind, namespace, name)
+	}
+
+	return o.FormatValue(value), nil
+}
+
 func GetBeKindConfig(cfg *rest.Config, ctx context.Context, ns string, name string) ([]byte, error) {
 	// Create Kubernetes cilent
 	client, err := kubernetes.NewForConfig(cfg)
@@ -20,10 +20,18 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/christianh814/bekind/pkg/config"
 	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -46,7 +54,7 @@ func TestGetDefaultRuntime(t *testing.T) {
 		{
 			name:     "no provider set",
 			envValue: "",
-			isNil:    true,
+			isNil:    false,
 		},
 		{
 			name:     "docker provider",
@@ -58,10 +66,15 @@ func TestGetDefaultRuntime(t *testing.T) {
 			envValue: "podman",
 			isNil:    false,
 		},
+		{
+			name:     "nerdctl provider",
+			envValue: "nerdctl",
+			isNil:    false,
+		},
 		{
 			name:     "unknown provider",
 			envValue: "unknown",
-			isNil:    true,
+			isNil:    false,
 		},
 	}
 
@@ -320,7 +333,7 @@ func TestSaveBeKindConfig(t *testing.T) {
 		}
 	}()
 
-	err := SaveBeKindConfig(nil, context.TODO(), "test-ns", "test-name")
+	err := SaveBeKindConfig(nil, context.TODO(), "test-ns", "test-name", config.New())
 	if err == nil {
 		t.Error("SaveBeKindConfig should fail with nil config")
 	}
@@ -340,6 +353,81 @@ func TestGetBeKindConfig(t *testing.T) {
 	}
 }
 
+func TestSaveCompletedSteps(t *testing.T) {
+	ctx := context.TODO()
+	clientset := fake.NewSimpleClientset()
+
+	// The ConfigMap is created the first time
+	if err := SaveCompletedSteps(clientset, ctx, "kube-public", "bekind-steps", []string{"cluster"}); err != nil {
+		t.Fatalf("SaveCompletedSteps returned error: %v", err)
+	}
+	cm, err := clientset.CoreV1().ConfigMaps("kube-public").Get(ctx, "bekind-steps", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected the ConfigMap to be created, got: %v", err)
+	}
+	if cm.Data["completed"] != "cluster" {
+		t.Errorf("Expected completed 'cluster', got '%s'", cm.Data["completed"])
+	}
+
+	// And updated after that
+	if err := SaveCompletedSteps(clientset, ctx, "kube-public", "bekind-steps", []string{"cluster", "registry"}); err != nil {
+		t.Fatalf("SaveCompletedSteps returned error: %v", err)
+	}
+	cm, err = clientset.CoreV1().ConfigMaps("kube-public").Get(ctx, "bekind-steps", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get the ConfigMap: %v", err)
+	}
+	if cm.Data["completed"] != "cluster,registry" {
+		t.Errorf("Expected completed 'cluster,registry', got '%s'", cm.Data["completed"])
+	}
+}
+
+func TestSaveLocalRegistryHosting(t *testing.T) {
+	// Test with nil config - this should fail gracefully
+	defer func() {
+		if r := recover(); r != nil {
+			// If it panics, that's expected behavior with nil config
+		}
+	}()
+
+	err := SaveLocalRegistryHosting(nil, context.TODO(), "test-ns", "localhost:5001")
+	if err == nil {
+		t.Error("SaveLocalRegistryHosting should fail with nil config")
+	}
+}
+
+func TestGetCompletedSteps(t *testing.T) {
+	ctx := context.TODO()
+
+	// Nothing is recorded until the ConfigMap is there
+	clientset := fake.NewSimpleClientset()
+	steps, err := GetCompletedSteps(clientset, ctx, "kube-public", "bekind-steps")
+	if err != nil || steps != nil {
+		t.Errorf("Expected no steps without the ConfigMap, got %v (%v)", steps, err)
+	}
+
+	// Or while it has no steps in it
+	clientset = fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "bekind-steps", Namespace: "kube-public"},
+	})
+	steps, err = GetCompletedSteps(clientset, ctx, "kube-public", "bekind-steps")
+	if err != nil || steps != nil {
+		t.Errorf("Expected no steps from an empty ConfigMap, got %v (%v)", steps, err)
+	}
+
+	// Saved steps are read back in order
+	if err := SaveCompletedSteps(clientset, ctx, "kube-public", "bekind-steps", []string{"cluster", "registry", "workers"}); err != nil {
+		t.Fatalf("SaveCompletedSteps returned error: %v", err)
+	}
+	steps, err = GetCompletedSteps(clientset, ctx, "kube-public", "bekind-steps")
+	if err != nil {
+		t.Fatalf("GetCompletedSteps returned error: %v", err)
+	}
+	if strings.Join(steps, ",") != "cluster,registry,workers" {
+		t.Errorf("Expected steps [cluster registry workers], got %v", steps)
+	}
+}
+
 func TestGetPostInstallBytes(t *testing.T) {
 	// Test with invalid URL scheme
 	_, err := getPostInstallBytes("invalid://test")
@@ -586,3 +674,73 @@ func TestPostInstallAction_Validation(t *testing.T) {
 		})
 	}
 }
+
+func TestGetOutput(t *testing.T) {
+	objects := []runtime.Object{
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1", "kind": "Secret",
+			"metadata": map[string]interface{}{"name": "admin", "namespace": "argocd"},
+			"data":     map[string]interface{}{"password": "czNjcmV0"},
+		}},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1", "kind": "ConfigMap",
+			"metadata": map[string]interface{}{"name": "settings", "namespace": "default"},
+			"data":     map[string]interface{}{"realm": "dev"},
+		}},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1", "kind": "Ingress",
+			"metadata": map[string]interface{}{"name": "web", "namespace": "argocd"},
+			"spec":     map[string]interface{}{"rules": []interface{}{map[string]interface{}{"host": "argocd.127.0.0.1.nip.io"}}},
+		}},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "gateway.networking.k8s.io/v1", "kind": "HTTPRoute",
+			"metadata": map[string]interface{}{"name": "web", "namespace": "argocd"},
+			"spec":     map[string]interface{}{"hostnames": []interface{}{"route.127.0.0.1.nip.io"}},
+		}},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1", "kind": "Service",
+			"metadata": map[string]interface{}{"name": "web", "namespace": "default"},
+			"spec": map[string]interface{}{"ports": []interface{}{
+				map[string]interface{}{"name": "http", "port": int64(80), "nodePort": int64(30080)},
+				map[string]interface{}{"name": "https", "port": int64(443), "nodePort": int64(30443)},
+			}},
+		}},
+	}
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+
+	testCases := []struct {
+		name     string
+		output   config.Output
+		expected string
+	}{
+		{"secret key", config.Output{Name: "password", Secret: "admin", Key: "password", Namespace: "argocd"}, "s3cret"},
+		{"configmap key", config.Output{Name: "realm", ConfigMap: "settings", Key: "realm"}, "dev"},
+		{"ingress host", config.Output{Name: "url", Ingress: "web", Namespace: "argocd", Format: "https://%s"}, "https://argocd.127.0.0.1.nip.io"},
+		{"httproute hostname", config.Output{Name: "url", HTTPRoute: "web", Namespace: "argocd"}, "route.127.0.0.1.nip.io"},
+		{"first service port", config.Output{Name: "port", Service: "web"}, "30080"},
+		{"service port by name", config.Output{Name: "port", Service: "web", Port: "https"}, "30443"},
+		{"service port by number", config.Output{Name: "port", Service: "web", Port: "443"}, "30443"},
+		{"jsonPath", config.Output{Name: "name", ConfigMap: "settings", JSONPath: "{.metadata.namespace}/{.metadata.name}"}, "default/settings"},
+	}
+	for _, tc := range testCases {
+		value, err := getOutput(context.TODO(), dyn, tc.output)
+		if err != nil {
+			t.Errorf("%s: getOutput() returned error: %v", tc.name, err)
+			continue
+		}
+		if value != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, value)
+		}
+	}
+
+	// Missing objects are NotFound errors, missing values are errors too
+	if _, err := getOutput(context.TODO(), dyn, config.Output{Name: "url", Ingress: "missing"}); !apierrors.IsNotFound(err) {
+		t.Errorf("Expected a NotFound error, got %v", err)
+	}
+	if _, err := getOutput(context.TODO(), dyn, config.Output{Name: "realm", ConfigMap: "settings", Key: "missing"}); err == nil || apierrors.IsNotFound(err) {
+		t.Errorf("Expected an error for a missing key, got %v", err)
+	}
+	if _, err := getOutput(context.TODO(), dyn, config.Output{Name: "port", Service: "web", Port: "grpc"}); err == nil {
+		t.Error("Expected an error for a missing port")
+	}
+}